@@ -0,0 +1,130 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"strings"
+)
+
+// Exit codes of the CLI, one per kind of error
+const (
+	exit_failure            = 1 // anything else, including failed tasks
+	exit_usage              = 2 // bad arguments or unknown task names
+	exit_parse              = 3 // dag.yaml is not valid YAML or has the wrong shape, or a query does not parse
+	exit_unknown_dependency = 4 // a task depends on a task that is not defined
+	exit_cycle              = 5 // the dependencies contain a cycle
+	exit_download           = 6 // dag.yaml could not be downloaded
+	exit_integrity          = 7 // the digest or signature of dag.yaml does not match
+)
+
+// ErrUnknownTask is returned when a task named on the command line or in a request is not in the DAG
+var ErrUnknownTask = errors.New("unknown task")
+
+// ErrIntegrity is returned when dag.yaml does not match the pinned digest or the configured signature
+var ErrIntegrity = errors.New("integrity check failed")
+
+// ErrCycle reports a dependency cycle; Path starts and ends with the same task
+type ErrCycle struct {
+	Path []string
+}
+
+func (e *ErrCycle) Error() string {
+	return "dependency cycle: " + strings.Join(e.Path, " -> ")
+}
+
+// ErrUnknownDependency reports a dependency on a task that is not defined
+type ErrUnknownDependency struct {
+	Task       string
+	Dependency string
+}
+
+func (e *ErrUnknownDependency) Error() string {
+	return fmt.Sprintf("task %q depends on unknown task %q", e.Task, e.Dependency)
+}
+
+// ErrParse reports invalid YAML or a schema violation; Line and Column are 1-based and 0 when unknown.
+// Path locates the offending value, e.g. dag."install go"[0], and is empty for syntax errors.
+type ErrParse struct {
+	Location string
+	Line     int
+	Column   int
+	Path     string
+	Message  string
+	Err      error
+}
+
+func (e *ErrParse) Error() string {
+	position := e.Location
+	if e.Line > 0 {
+		position += fmt.Sprintf(":%d", e.Line)
+		if e.Column > 0 {
+			position += fmt.Sprintf(":%d", e.Column)
+		}
+	}
+	if e.Path != "" {
+		position += ": " + e.Path
+	}
+	return position + ": " + e.Message
+}
+
+func (e *ErrParse) Unwrap() error {
+	return e.Err
+}
+
+// ErrDownload reports a failed download; Status_code is 0 when no HTTP response was received
+type ErrDownload struct {
+	Url         string
+	Status_code int
+	Err         error
+}
+
+func (e *ErrDownload) Error() string {
+	return fmt.Sprintf("download %s: %v", e.Url, e.Err)
+}
+
+func (e *ErrDownload) Unwrap() error {
+	return e.Err
+}
+
+// exit_code maps an error to the exit code of its kind
+func exit_code(err error) int {
+	var cycle *ErrCycle
+	var unknown_dependency *ErrUnknownDependency
+	var parse *ErrParse
+	var download *ErrDownload
+	switch {
+	case errors.Is(err, ErrUnknownTask):
+		return exit_usage
+	case errors.Is(err, ErrIntegrity):
+		return exit_integrity
+	case errors.As(err, &cycle):
+		return exit_cycle
+	case errors.As(err, &unknown_dependency):
+		return exit_unknown_dependency
+	case errors.As(err, &parse):
+		return exit_parse
+	case errors.As(err, &download):
+		return exit_download
+	}
+	return exit_failure
+}
+
+// fatal_error logs err under msg, one record per joined error, and exits with the exit code of its kind
+func fatal_error(msg string, err error) {
+	if joined, ok := err.(interface{ Unwrap() []error }); ok {
+		for _, each := range joined.Unwrap() {
+			slog.Error(msg, "error", each)
+		}
+	} else {
+		slog.Error(msg, "error", err)
+	}
+	os.Exit(exit_code(err))
+}
+
+// fatal_usage logs msg with its attributes and exits with exit_usage
+func fatal_usage(msg string, args ...any) {
+	slog.Error(msg, args...)
+	os.Exit(exit_usage)
+}
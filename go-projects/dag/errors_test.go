@@ -0,0 +1,41 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"testing"
+)
+
+func Test_exit_code(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want int
+	}{
+		{"unknown task", ErrUnknownTask, exit_usage},
+		{"wrapped unknown task", fmt.Errorf("%w: build", ErrUnknownTask), exit_usage},
+		{"integrity", ErrIntegrity, exit_integrity},
+		{"wrapped integrity", fmt.Errorf("verify: %w", fmt.Errorf("%w: bad signature", ErrIntegrity)), exit_integrity},
+		{"cycle", &ErrCycle{Path: []string{"a", "b", "a"}}, exit_cycle},
+		{"wrapped cycle", fmt.Errorf("check: %w", &ErrCycle{Path: []string{"a", "a"}}), exit_cycle},
+		{"unknown dependency", &ErrUnknownDependency{Task: "a", Dependency: "b"}, exit_unknown_dependency},
+		{"wrapped unknown dependency", fmt.Errorf("check: %w", &ErrUnknownDependency{Task: "a", Dependency: "b"}), exit_unknown_dependency},
+		{"parse", &ErrParse{Location: "dag.yaml", Message: "bad"}, exit_parse},
+		{"wrapped parse", fmt.Errorf("load: %w", &ErrParse{Location: "query", Message: "bad"}), exit_parse},
+		{"download", &ErrDownload{Url: "https://example.invalid", Err: errors.New("timeout")}, exit_download},
+		{"wrapped download", fmt.Errorf("fetch: %w", &ErrDownload{Url: "https://example.invalid", Status_code: 404}), exit_download},
+		{"joined: a cycle outranks an unknown dependency", errors.Join(&ErrCycle{}, &ErrUnknownDependency{}), exit_cycle},
+		{"joined with a plain error", errors.Join(errors.New("plain"), &ErrUnknownDependency{}), exit_unknown_dependency},
+		{"parse wrapping a file error", &ErrParse{Location: "dag.yaml", Err: fs.ErrNotExist}, exit_parse},
+		{"other", errors.New("task failed"), exit_failure},
+		{"wrapped other", fmt.Errorf("run: %w", fs.ErrPermission), exit_failure},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := exit_code(test.err); got != test.want {
+				t.Errorf("exit_code(%v) = %d, want %d", test.err, got, test.want)
+			}
+		})
+	}
+}
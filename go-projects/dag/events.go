@@ -0,0 +1,131 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"sync"
+	"time"
+)
+
+// Event types published while a run executes
+const (
+	event_run_started   = "run_started"
+	event_task_started  = "task_started"
+	event_task_output   = "task_output"
+	event_task_finished = "task_finished"
+	event_run_finished  = "run_finished"
+)
+
+// run_event is a single structured progress event of a run
+type run_event struct {
+	Type        string         `json:"type"`
+	Time        string         `json:"time"`
+	Run         int            `json:"run,omitempty"`
+	Task        string         `json:"task,omitempty"`
+	Output      string         `json:"output,omitempty"`
+	Status      string         `json:"status,omitempty"`
+	Error       string         `json:"error,omitempty"`
+	Duration_ms float64        `json:"duration_ms,omitempty"`
+	Blocked_by  string         `json:"blocked_by,omitempty"`
+	Allowed     bool           `json:"allowed_failure,omitempty"` // a failure the allow-failure policy let dependents ignore
+	Counts      map[string]int `json:"counts,omitempty"`
+}
+
+// event_bus fans published events out to every current subscriber
+type event_bus struct {
+	mutex       sync.Mutex
+	subscribers map[chan run_event]bool // channel -> lossless
+}
+
+// new_event_bus returns a bus without subscribers
+func new_event_bus() *event_bus {
+	return &event_bus{subscribers: make(map[chan run_event]bool)}
+}
+
+// subscribe returns a channel receiving every event published from now on, and a function to unsubscribe.
+// A lossless subscriber slows the run down when it falls behind; any other subscriber misses events instead.
+func (bus *event_bus) subscribe(lossless bool) (chan run_event, func()) {
+	ch := make(chan run_event, 256)
+	bus.mutex.Lock()
+	bus.subscribers[ch] = lossless
+	bus.mutex.Unlock()
+	return ch, func() {
+		bus.mutex.Lock()
+		delete(bus.subscribers, ch)
+		bus.mutex.Unlock()
+	}
+}
+
+// publish stamps event with the current time and delivers it to every subscriber
+func (bus *event_bus) publish(event run_event) {
+	if event.Time == "" {
+		event.Time = time.Now().Format(time.RFC3339Nano)
+	}
+	bus.mutex.Lock()
+	defer bus.mutex.Unlock()
+	for ch, lossless := range bus.subscribers {
+		if lossless {
+			ch <- event
+			continue
+		}
+		select {
+		case ch <- event:
+		default:
+		}
+	}
+}
+
+// start_ndjson_writer appends every event published on bus to path as newline-delimited JSON.
+// The returned stop function unsubscribes and waits for pending events to be written.
+func start_ndjson_writer(path string, bus *event_bus) (func(), error) {
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+	if err != nil {
+		return nil, err
+	}
+	ch, unsubscribe := bus.subscribe(true)
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		encoder := json.NewEncoder(file)
+		for event := range ch {
+			encoder.Encode(event)
+		}
+	}()
+	return func() {
+		unsubscribe()
+		close(ch)
+		<-done
+		file.Close()
+	}, nil
+}
+
+// event_line_writer publishes everything written to it as task_output events, one per line
+type event_line_writer struct {
+	task    string
+	publish func(run_event)
+	buffer  bytes.Buffer
+}
+
+// Write implements io.Writer
+func (w *event_line_writer) Write(p []byte) (int, error) {
+	w.buffer.Write(p)
+	for {
+		line, err := w.buffer.ReadString('\n')
+		if err != nil {
+			// Keep the incomplete line for the next write
+			w.buffer.Reset()
+			w.buffer.WriteString(line)
+			return len(p), nil
+		}
+		w.publish(run_event{Type: event_task_output, Task: w.task, Output: line[:len(line)-1]})
+	}
+}
+
+// flush publishes a trailing line that did not end with a newline
+func (w *event_line_writer) flush() {
+	if w.buffer.Len() > 0 {
+		w.publish(run_event{Type: event_task_output, Task: w.task, Output: w.buffer.String()})
+		w.buffer.Reset()
+	}
+}
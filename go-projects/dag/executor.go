@@ -0,0 +1,191 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"runtime"
+	"sort"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Task kinds of a run: entry. A plain string is a shell command.
+const (
+	kind_shell            = "shell"
+	kind_pwsh             = "pwsh"
+	kind_choco            = "choco"
+	kind_winget           = "winget"
+	kind_vscode_extension = "vscode_extension"
+)
+
+// task_command is what a task runs: a shell command, or a package or extension to install with one of the backends.
+// In dag.yaml it is either a string, `run: {task: "Write-Host hi"}`, or a mapping with exactly one kind as its key,
+// `run: {install notepad++: {choco: notepadplusplus}}`.
+type task_command struct {
+	Kind     string // one of the kind_ constants
+	Argument string // the command for shell and pwsh, the package or extension id otherwise
+}
+
+func (command *task_command) UnmarshalYAML(node *yaml.Node) error {
+	if node.Kind == yaml.ScalarNode {
+		*command = task_command{Kind: kind_shell, Argument: node.Value}
+		return nil
+	}
+	var kinds map[string]string
+	if err := node.Decode(&kinds); err != nil {
+		return err
+	}
+	if len(kinds) != 1 {
+		return fmt.Errorf("line %d: a task command needs exactly one of %s", node.Line, strings.Join(task_kinds(), ", "))
+	}
+	for kind, argument := range kinds {
+		if _, ok := executor_backends[kind]; !ok {
+			return fmt.Errorf("line %d: unknown task kind %q (expected one of %s)", node.Line, kind, strings.Join(task_kinds(), ", "))
+		}
+		*command = task_command{Kind: kind, Argument: argument}
+	}
+	return nil
+}
+
+func (command task_command) MarshalYAML() (any, error) {
+	if command.Kind == kind_shell || command.Kind == "" {
+		return command.Argument, nil
+	}
+	return map[string]string{command.Kind: command.Argument}, nil
+}
+
+// script returns the command as PowerShell: the shell command itself, or the backend's invocation.
+// Exporters, task logs and the UIs show this.
+func (command task_command) script() string {
+	return command.script_quoted(powershell_quote)
+}
+
+// script_quoted is script for another shell, quoting the arguments of a backend invocation with quote
+func (command task_command) script_quoted(quote func(string) string) string {
+	if command.Kind == kind_shell || command.Kind == "" {
+		return command.Argument
+	}
+	argv := executor_backends[command.Kind](command.Argument, "windows")
+	quoted := make([]string, len(argv))
+	for i, arg := range argv {
+		if strings.ContainsAny(arg, " \t\n'\"$`;&|<>(){}") {
+			arg = quote(arg)
+		}
+		quoted[i] = arg
+	}
+	return strings.Join(quoted, " ")
+}
+
+// executor_backends maps each task kind to the program and arguments that run it on goos
+var executor_backends = map[string]func(argument string, goos string) []string{
+	kind_shell: func(argument string, goos string) []string {
+		if goos == "windows" {
+			return []string{"powershell.exe", "-NoProfile", "-NonInteractive", "-Command", argument}
+		}
+		return []string{"sh", "-c", argument}
+	},
+	kind_pwsh: func(argument string, goos string) []string {
+		return []string{"pwsh", "-NoProfile", "-NonInteractive", "-Command", argument}
+	},
+	kind_choco: func(argument string, goos string) []string {
+		return []string{"choco", "install", argument, "--yes", "--no-progress"}
+	},
+	kind_winget: func(argument string, goos string) []string {
+		return []string{"winget", "install", "--id", argument, "--exact", "--silent",
+			"--accept-package-agreements", "--accept-source-agreements"}
+	},
+	kind_vscode_extension: func(argument string, goos string) []string {
+		return []string{"code", "--install-extension", argument, "--force"}
+	},
+}
+
+// task_kinds returns the supported task kinds in alphabetical order
+func task_kinds() []string {
+	kinds := make([]string, 0, len(executor_backends))
+	for kind := range executor_backends {
+		kinds = append(kinds, kind)
+	}
+	sort.Strings(kinds)
+	return kinds
+}
+
+// Executor runs the command of one task, sending its output to output. It stops the command when ctx is cancelled.
+type Executor interface {
+	Execute(ctx context.Context, task string, command task_command, output io.Writer) error
+}
+
+// command_runner starts a program with env added to the inherited environment; the seam between the backends
+// and the operating system
+type command_runner interface {
+	run(ctx context.Context, argv []string, env []string, output io.Writer) error
+}
+
+// task_environment returns the variables the command of task gets on top of the environment of dag run
+func task_environment(task string) []string {
+	return []string{"DAG_TASK=" + task}
+}
+
+// backend_executor is the Executor of dag run: it turns each task kind into a program invocation
+type backend_executor struct {
+	runner command_runner
+	goos   string
+}
+
+// new_executor returns the executor that runs tasks on this machine through runner
+func new_executor(runner command_runner) *backend_executor {
+	return &backend_executor{runner: runner, goos: runtime.GOOS}
+}
+
+// Execute runs command with its backend. Tasks without a command succeed immediately.
+func (executor *backend_executor) Execute(ctx context.Context, task string, command task_command, output io.Writer) error {
+	if command.Argument == "" {
+		return nil
+	}
+	kind := command.Kind
+	if kind == "" {
+		kind = kind_shell
+	}
+	backend, ok := executor_backends[kind]
+	if !ok {
+		return fmt.Errorf("unknown task kind %q", kind)
+	}
+	return executor.runner.run(ctx, backend(command.Argument, executor.goos), task_environment(task), output)
+}
+
+// process_wait_delay is how long a cancelled command may keep its output open after its process tree is killed
+const process_wait_delay = time.Second
+
+// exec_runner runs programs with os/exec. Cancelling the context kills the program and every process it started.
+type exec_runner struct{}
+
+func (exec_runner) run(ctx context.Context, argv []string, env []string, output io.Writer) error {
+	cmd := exec.CommandContext(ctx, argv[0], argv[1:]...)
+	cmd.Env = append(os.Environ(), env...)
+	cmd.Stdout = output
+	cmd.Stderr = output
+	// Once cancelled, Wait stops waiting for output from processes that escaped the process tree
+	cmd.WaitDelay = process_wait_delay
+	tree, err := start_process_tree(cmd)
+	if err != nil {
+		return err
+	}
+	defer tree.release()
+	return cmd.Wait()
+}
+
+// dry_run_runner prints each invocation instead of running it, for dag run --dry-run
+type dry_run_runner struct{}
+
+func (dry_run_runner) run(ctx context.Context, argv []string, env []string, output io.Writer) error {
+	quoted := make([]string, len(argv))
+	for i, arg := range argv {
+		quoted[i] = fmt.Sprintf("%q", arg)
+	}
+	_, err := fmt.Fprintf(output, "would run: %s\n", strings.Join(quoted, " "))
+	return err
+}
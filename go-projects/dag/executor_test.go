@@ -0,0 +1,106 @@
+package main
+
+import (
+	"context"
+	"io"
+	"reflect"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+)
+
+// recording_runner is a command_runner that records every argv and environment instead of starting a program
+type recording_runner struct {
+	calls        [][]string
+	environments [][]string
+}
+
+func (runner *recording_runner) run(ctx context.Context, argv []string, env []string, output io.Writer) error {
+	runner.calls = append(runner.calls, argv)
+	runner.environments = append(runner.environments, env)
+	return nil
+}
+
+func Test_backend_executor(t *testing.T) {
+	tests := []struct {
+		command task_command
+		goos    string
+		want    []string
+	}{
+		{task_command{Kind: kind_shell, Argument: "echo hi"}, "windows",
+			[]string{"powershell.exe", "-NoProfile", "-NonInteractive", "-Command", "echo hi"}},
+		{task_command{Kind: kind_shell, Argument: "echo hi"}, "linux", []string{"sh", "-c", "echo hi"}},
+		{task_command{Argument: "echo hi"}, "linux", []string{"sh", "-c", "echo hi"}},
+		{task_command{Kind: kind_pwsh, Argument: "Write-Host hi"}, "linux",
+			[]string{"pwsh", "-NoProfile", "-NonInteractive", "-Command", "Write-Host hi"}},
+		{task_command{Kind: kind_choco, Argument: "notepadplusplus"}, "windows",
+			[]string{"choco", "install", "notepadplusplus", "--yes", "--no-progress"}},
+		{task_command{Kind: kind_winget, Argument: "Git.Git"}, "windows",
+			[]string{"winget", "install", "--id", "Git.Git", "--exact", "--silent",
+				"--accept-package-agreements", "--accept-source-agreements"}},
+		{task_command{Kind: kind_vscode_extension, Argument: "golang.go"}, "windows",
+			[]string{"code", "--install-extension", "golang.go", "--force"}},
+	}
+	for _, test := range tests {
+		runner := &recording_runner{}
+		executor := &backend_executor{runner: runner, goos: test.goos}
+		if err := executor.Execute(context.Background(), "task", test.command, io.Discard); err != nil {
+			t.Errorf("%s on %s: %v", test.command.Kind, test.goos, err)
+			continue
+		}
+		if !reflect.DeepEqual(runner.calls, [][]string{test.want}) {
+			t.Errorf("%s on %s: got %q, want %q", test.command.Kind, test.goos, runner.calls, test.want)
+		}
+		if want := [][]string{{"DAG_TASK=task"}}; !reflect.DeepEqual(runner.environments, want) {
+			t.Errorf("%s on %s: got environment %q, want %q", test.command.Kind, test.goos, runner.environments, want)
+		}
+	}
+}
+
+func Test_backend_executor_without_command(t *testing.T) {
+	runner := &recording_runner{}
+	executor := &backend_executor{runner: runner, goos: "windows"}
+	if err := executor.Execute(context.Background(), "task", task_command{}, io.Discard); err != nil {
+		t.Errorf("empty command: %v", err)
+	}
+	if err := executor.Execute(context.Background(), "task", task_command{Kind: "apt", Argument: "git"}, io.Discard); err == nil {
+		t.Errorf("unknown kind: got no error")
+	}
+	if len(runner.calls) != 0 {
+		t.Errorf("got %q, want no programs started", runner.calls)
+	}
+}
+
+func Test_dry_run_runner(t *testing.T) {
+	var output strings.Builder
+	executor := &backend_executor{runner: dry_run_runner{}, goos: "windows"}
+	if err := executor.Execute(context.Background(), "task", task_command{Kind: kind_choco, Argument: "git"}, &output); err != nil {
+		t.Fatal(err)
+	}
+	want := `would run: "choco" "install" "git" "--yes" "--no-progress"` + "\n"
+	if output.String() != want {
+		t.Errorf("got %q, want %q", output.String(), want)
+	}
+}
+
+func Test_exec_runner_cancel_kills_process_tree(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("uses sh")
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	var output strings.Builder
+	start := time.Now()
+	// sh waits for the sleep, which holds the output pipe open: killing sh alone leaves Wait blocked for 5s
+	err := exec_runner{}.run(ctx, []string{"sh", "-c", "sleep 5; echo done"}, nil, &output)
+	if err == nil {
+		t.Fatal("got no error from a cancelled command")
+	}
+	if elapsed := time.Since(start); elapsed >= process_wait_delay {
+		t.Errorf("cancelled command returned after %s, want the process tree killed at once", elapsed)
+	}
+	if strings.Contains(output.String(), "done") {
+		t.Errorf("command kept running after it was cancelled: %q", output.String())
+	}
+}
@@ -0,0 +1,365 @@
+package main
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// export_input is what every exporter renders from
+type export_input struct {
+	parsed   dag_file
+	location string            // where dag.yaml was read from, for the generated header
+	names    map[string]string // task -> sanitised target name, unique across the DAG
+	order    []string          // tasks by level, then by name: every task after its dependencies
+	roots    []string          // tasks nothing depends on, which together cover the whole DAG
+	group    string            // --group: one CI job per "task" or per "level"
+}
+
+// policy_of returns the failure policy of task from the policy: section, as dag run resolves it without --on-failure
+func (input export_input) policy_of(task string) string {
+	return run_options{policies: input.parsed.Policy}.policy_of(task)
+}
+
+// exporters maps each --format to the function that renders it
+var exporters = map[string]func(export_input) (string, error){
+	"make":           export_make,
+	"just":           export_just,
+	"taskfile":       export_taskfile,
+	"powershell":     export_powershell,
+	"bash":           export_bash,
+	"github-actions": export_github_actions,
+	"ansible":        export_ansible,
+}
+
+// reserved_target_names are the aggregate targets the exporters add, which tasks must not be renamed to
+var reserved_target_names = []string{"all", "default"}
+
+// run_export renders the DAG in another tool's format
+func run_export(args []string) {
+	flags := flag.NewFlagSet("export", flag.ExitOnError)
+	add_logging_flags(flags)
+	format := flags.String("format", "", "output format: "+strings.Join(export_formats(), ", "))
+	output := flags.String("output", "", "file to write (default: standard output)")
+	group := flags.String("group", group_task, "github-actions: one job per task or per level")
+	add_source_flags(flags)
+	flags.Parse(args)
+
+	exporter, ok := exporters[*format]
+	if !ok {
+		fatal_usage("unknown_export_format", "format", *format, "formats", strings.Join(export_formats(), ", "))
+	}
+
+	// Step 1: Load and check the DAG
+	parsed, digest, err := load_dag_source()
+	if err != nil {
+		fatal_error("dag_load_failed", err)
+	}
+	if err := check_dag(parsed.Dag); err != nil {
+		fatal_error("dag_invalid", err)
+	}
+
+	// Step 2: Render
+	input := new_export_input(parsed, digest.Location)
+	input.group = *group
+	content, err := exporter(input)
+	if err != nil {
+		fatal("export_failed", "format", *format, "error", err)
+	}
+
+	// Step 3: Write
+	if *output == "" {
+		fmt.Print(content)
+		return
+	}
+	if err := os.WriteFile(*output, []byte(content), 0o644); err != nil {
+		fatal("file_write_failed", "error", err)
+	}
+	fmt.Printf("📤 wrote %s (%d tasks as %s)\n", *output, len(parsed.Dag), *format)
+}
+
+// export_formats returns the supported --format values in alphabetical order
+func export_formats() []string {
+	formats := make([]string, 0, len(exporters))
+	for format := range exporters {
+		formats = append(formats, format)
+	}
+	sort.Strings(formats)
+	return formats
+}
+
+// new_export_input sanitises the task names and orders the tasks for rendering
+func new_export_input(parsed dag_file, location string) export_input {
+	levels := compute_levels(parsed.Dag)
+	order := sorted_tasks(parsed.Dag)
+	sort.SliceStable(order, func(i, j int) bool {
+		return levels[order[i]] < levels[order[j]]
+	})
+
+	reverse := build_reverse_graph(parsed.Dag)
+	var roots []string
+	for _, task := range sorted_tasks(parsed.Dag) {
+		if len(reverse[task]) == 0 {
+			roots = append(roots, task)
+		}
+	}
+
+	return export_input{
+		parsed:   parsed,
+		location: location,
+		names:    sanitise_task_names(parsed.Dag),
+		order:    order,
+		roots:    roots,
+	}
+}
+
+// sanitise_task_names maps every task to a name that is valid as a make target, a just recipe and a task key:
+// letters, digits, '_' and '-', starting with a letter. Clashes get a numeric suffix in alphabetical order.
+func sanitise_task_names(dag map[string][]string) map[string]string {
+	used := make(map[string]bool)
+	for _, name := range reserved_target_names {
+		used[name] = true
+	}
+	names := make(map[string]string)
+	for _, task := range sorted_tasks(dag) {
+		base := sanitise_task_name(task)
+		name := base
+		for i := 2; used[name]; i++ {
+			name = fmt.Sprintf("%s-%d", base, i)
+		}
+		used[name] = true
+		names[task] = name
+	}
+	return names
+}
+
+// sanitise_task_name replaces every run of other characters by a single '-'
+func sanitise_task_name(task string) string {
+	var name strings.Builder
+	dash := false
+	for _, r := range task {
+		if r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || r == '_' {
+			name.WriteRune(r)
+			dash = false
+		} else if !dash && name.Len() > 0 {
+			name.WriteByte('-')
+			dash = true
+		}
+	}
+	result := strings.TrimSuffix(name.String(), "-")
+	if result == "" || (result[0] >= '0' && result[0] <= '9') || result[0] == '_' {
+		result = "task-" + result
+	}
+	return strings.TrimSuffix(result, "-")
+}
+
+// target_names returns the sanitised names of tasks
+func (input export_input) target_names(tasks []string) []string {
+	names := make([]string, len(tasks))
+	for i, task := range tasks {
+		names[i] = input.names[task]
+	}
+	return names
+}
+
+// sorted_dependencies returns the dependencies of task in alphabetical order
+func (input export_input) sorted_dependencies(task string) []string {
+	deps := append([]string(nil), input.parsed.Dag[task]...)
+	sort.Strings(deps)
+	return deps
+}
+
+// export_make renders a Makefile with one phony target per task. Recipes run through PowerShell on Windows,
+// like dag run, and .ONESHELL keeps multi-line commands in one shell. The recipes of allow-failure tasks ignore
+// their errors. make stops starting tasks after any other failure, like fail-fast; make -k keeps going like continue.
+func export_make(input export_input) (string, error) {
+	var out strings.Builder
+	fmt.Fprintf(&out, "# Generated by dag export from %s. Do not edit; re-run dag export instead.\n", input.location)
+	out.WriteString("# Run make -k to keep running independent tasks after a failure.\n\n")
+	out.WriteString("ifeq ($(OS),Windows_NT)\n")
+	out.WriteString("SHELL := powershell.exe\n")
+	out.WriteString(".SHELLFLAGS := -NoProfile -NonInteractive -Command\n")
+	out.WriteString("endif\n")
+	out.WriteString(".ONESHELL:\n\n")
+
+	out.WriteString(".PHONY: all\n")
+	fmt.Fprintf(&out, "all: %s\n", strings.Join(input.target_names(input.roots), " "))
+
+	for _, task := range input.order {
+		fmt.Fprintf(&out, "\n# %s\n", task)
+		fmt.Fprintf(&out, ".PHONY: %s\n", input.names[task])
+		line := input.names[task] + ":"
+		if deps := input.sorted_dependencies(task); len(deps) > 0 {
+			line += " " + strings.Join(input.target_names(deps), " ")
+		}
+		out.WriteString(line + "\n")
+		for i, command_line := range command_lines(input.parsed.Run[task].script()) {
+			if i == 0 && input.policy_of(task) == policy_allow_failure {
+				command_line = "-" + command_line // with .ONESHELL the prefix applies to the whole recipe
+			}
+			out.WriteString("\t" + strings.ReplaceAll(command_line, "$", "$$") + "\n")
+		}
+	}
+	return out.String(), nil
+}
+
+// export_just renders a justfile with one recipe per task, documented with the original task name.
+// just stops at the first failed recipe, which is fail-fast; allow-failure tasks prefix every line with -,
+// as each line runs in a shell of its own.
+func export_just(input export_input) (string, error) {
+	var out strings.Builder
+	fmt.Fprintf(&out, "# Generated by dag export from %s. Do not edit; re-run dag export instead.\n\n", input.location)
+	out.WriteString(`set windows-shell := ["powershell.exe", "-NoProfile", "-NonInteractive", "-Command"]` + "\n\n")
+
+	out.WriteString("# Run every task\n")
+	fmt.Fprintf(&out, "default: %s\n", strings.Join(input.target_names(input.roots), " "))
+
+	for _, task := range input.order {
+		fmt.Fprintf(&out, "\n# %s\n", task)
+		line := input.names[task] + ":"
+		if deps := input.sorted_dependencies(task); len(deps) > 0 {
+			line += " " + strings.Join(input.target_names(deps), " ")
+		}
+		out.WriteString(line + "\n")
+		for _, command_line := range command_lines(input.parsed.Run[task].script()) {
+			if strings.TrimSpace(command_line) == "" {
+				continue // a blank line would end the recipe
+			}
+			if input.policy_of(task) == policy_allow_failure {
+				command_line = "-" + command_line
+			}
+			out.WriteString("    " + strings.ReplaceAll(command_line, "{{", "{{{{") + "\n")
+		}
+	}
+	return out.String(), nil
+}
+
+// taskfile is the subset of the Taskfile v3 schema that export_taskfile writes
+type taskfile struct {
+	Version string                   `yaml:"version"`
+	Tasks   map[string]taskfile_task `yaml:"tasks"`
+}
+
+type taskfile_task struct {
+	Desc string             `yaml:"desc,omitempty"`
+	Run  string             `yaml:"run,omitempty"`
+	Deps []string           `yaml:"deps,omitempty"`
+	Cmds []taskfile_command `yaml:"cmds,omitempty"`
+}
+
+// taskfile_command is one entry of cmds: a plain string, or {cmd, ignore_error} when a failure is ignored
+type taskfile_command struct {
+	Cmd          string `yaml:"cmd"`
+	Ignore_error bool   `yaml:"ignore_error,omitempty"`
+}
+
+func (command taskfile_command) MarshalYAML() (any, error) {
+	if !command.Ignore_error {
+		return command.Cmd, nil
+	}
+	type plain taskfile_command
+	return plain(command), nil
+}
+
+func (command *taskfile_command) UnmarshalYAML(value *yaml.Node) error {
+	if value.Kind == yaml.ScalarNode {
+		*command = taskfile_command{Cmd: value.Value}
+		return nil
+	}
+	type plain taskfile_command
+	return value.Decode((*plain)(command))
+}
+
+// export_taskfile renders a Taskfile.yml for go-task, with the original task name as each task's description.
+// Every task runs once per invocation, like a task of dag run: go-task would otherwise run a dependency shared by
+// several tasks once for each of them. go-task cancels the running dependencies when one fails, which is fail-fast;
+// the commands of allow-failure tasks ignore their errors.
+func export_taskfile(input export_input) (string, error) {
+	file := taskfile{
+		Version: "3",
+		Tasks: map[string]taskfile_task{
+			"default": {Desc: "Run every task", Run: "once", Deps: input.target_names(input.roots)},
+		},
+	}
+	for _, task := range input.order {
+		entry := taskfile_task{
+			Desc: task,
+			Run:  "once",
+			Deps: input.target_names(input.sorted_dependencies(task)),
+		}
+		if command := input.parsed.Run[task].script(); command != "" {
+			// go-task expands commands as Go templates; {{"{{"}} writes a literal {{
+			entry.Cmds = []taskfile_command{{
+				Cmd:          strings.ReplaceAll(command, "{{", `{{"{{"}}`),
+				Ignore_error: input.policy_of(task) == policy_allow_failure,
+			}}
+		}
+		file.Tasks[input.names[task]] = entry
+	}
+
+	var out strings.Builder
+	fmt.Fprintf(&out, "# Generated by dag export from %s. Do not edit; re-run dag export instead.\n", input.location)
+	encoder := yaml.NewEncoder(&out)
+	encoder.SetIndent(2)
+	if err := encoder.Encode(file); err != nil {
+		return "", err
+	}
+	if err := encoder.Close(); err != nil {
+		return "", err
+	}
+	return out.String(), nil
+}
+
+// command_lines splits a run command into lines, dropping a trailing newline
+func command_lines(command string) []string {
+	command = strings.TrimRight(command, "\r\n")
+	if command == "" {
+		return nil
+	}
+	return strings.Split(strings.ReplaceAll(command, "\r\n", "\n"), "\n")
+}
+
+// parse_make_prerequisites reads the rules of a Makefile as target -> prerequisites.
+// Variable assignments, special targets such as .PHONY, recipes and conditionals are skipped.
+func parse_make_prerequisites(content string) (map[string][]string, error) {
+	rules := make(map[string][]string)
+	scanner := bufio.NewScanner(strings.NewReader(content))
+	pending := ""
+	for scanner.Scan() {
+		line := scanner.Text()
+		if strings.HasSuffix(line, "\\") {
+			pending += strings.TrimSuffix(line, "\\") + " "
+			continue
+		}
+		line = pending + line
+		pending = ""
+
+		if strings.HasPrefix(line, "\t") {
+			continue // recipe
+		}
+		if hash := strings.Index(line, "#"); hash >= 0 {
+			line = line[:hash]
+		}
+		colon := strings.Index(line, ":")
+		if colon < 0 || strings.HasPrefix(line[colon:], ":=") || strings.HasPrefix(line[colon:], "::=") ||
+			strings.ContainsAny(line[:colon], "=") {
+			continue
+		}
+		prerequisites := strings.Fields(line[colon+1:])
+		if semicolon := strings.Index(line[colon+1:], ";"); semicolon >= 0 {
+			prerequisites = strings.Fields(line[colon+1 : colon+1+semicolon])
+		}
+		for _, target := range strings.Fields(line[:colon]) {
+			if strings.HasPrefix(target, ".") {
+				continue
+			}
+			rules[target] = append(rules[target], prerequisites...)
+		}
+	}
+	return rules, scanner.Err()
+}
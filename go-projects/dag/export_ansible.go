@@ -0,0 +1,63 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// ansible_play is a play of an Ansible playbook
+type ansible_play struct {
+	Name         string         `yaml:"name"`
+	Hosts        string         `yaml:"hosts"`
+	Gather_facts bool           `yaml:"gather_facts"`
+	Tasks        []ansible_task `yaml:"tasks"`
+}
+
+type ansible_task struct {
+	Name           string              `yaml:"name"`
+	Tags           []string            `yaml:"tags,omitempty"`
+	Ignore_errors  bool                `yaml:"ignore_errors,omitempty"`
+	Win_powershell *ansible_powershell `yaml:"ansible.windows.win_powershell,omitempty"`
+	Debug          *ansible_debug      `yaml:"ansible.builtin.debug,omitempty"`
+}
+
+type ansible_powershell struct {
+	Script string `yaml:"script"`
+}
+
+type ansible_debug struct {
+	Msg string `yaml:"msg"`
+}
+
+// export_ansible renders a playbook with one Windows PowerShell task per DAG task, in topological order.
+// Each task is tagged with its target name and its DAG tags, so ansible-playbook --tags matches the tag() query.
+// dag.yaml has no platform conditions, so the tasks carry no when: guards; the play targets every host.
+// Allow-failure tasks ignore their errors. Any other failure stops the host, as fail-fast would; Ansible cannot
+// skip only the dependents of a failed task the way the continue policy does.
+func export_ansible(input export_input) (string, error) {
+	play := ansible_play{Name: "dag", Hosts: "all"}
+	for _, task := range input.order {
+		tags := append([]string{input.names[task]}, input.parsed.Tags[task]...)
+		entry := ansible_task{Name: task, Tags: tags, Ignore_errors: input.policy_of(task) == policy_allow_failure}
+		if command := strings.TrimRight(input.parsed.Run[task].script(), "\r\n"); command != "" {
+			entry.Win_powershell = &ansible_powershell{Script: command}
+		} else {
+			entry.Debug = &ansible_debug{Msg: task + " has no command"}
+		}
+		play.Tasks = append(play.Tasks, entry)
+	}
+
+	var out strings.Builder
+	fmt.Fprintf(&out, "# Generated by dag export from %s. Do not edit; re-run dag export instead.\n", input.location)
+	encoder := yaml.NewEncoder(&out)
+	encoder.SetIndent(2)
+	if err := encoder.Encode([]ansible_play{play}); err != nil {
+		return "", err
+	}
+	if err := encoder.Close(); err != nil {
+		return "", err
+	}
+	return out.String(), nil
+}
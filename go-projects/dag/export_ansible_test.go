@@ -0,0 +1,56 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+
+	"gopkg.in/yaml.v3"
+)
+
+func Test_export_ansible(t *testing.T) {
+	parsed := dag_file{
+		Dag:  diamond_dag,
+		Tags: map[string][]string{"left": {"editor", "windows"}},
+		Run:  map[string]task_command{"base": {Kind: kind_choco, Argument: "git"}},
+	}
+	input := new_export_input(parsed, "dag.yaml")
+	content, err := export_ansible(input)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var plays []ansible_play
+	if err := yaml.Unmarshal([]byte(content), &plays); err != nil {
+		t.Fatalf("playbook is not valid YAML: %v\n%s", err, content)
+	}
+	if len(plays) != 1 {
+		t.Fatalf("got %d plays, want 1", len(plays))
+	}
+
+	position := make(map[string]int)
+	for i, task := range plays[0].Tasks {
+		position[task.Name] = i
+	}
+	if len(position) != len(diamond_dag) {
+		t.Fatalf("got tasks %v, want one per task of %v", position, diamond_dag)
+	}
+	for task, deps := range diamond_dag {
+		for _, dep := range deps {
+			if position[dep] > position[task] {
+				t.Errorf("%s runs before its dependency %s", task, dep)
+			}
+		}
+	}
+
+	for _, task := range plays[0].Tasks {
+		want := append([]string{input.names[task.Name]}, parsed.Tags[task.Name]...)
+		if !reflect.DeepEqual(task.Tags, want) {
+			t.Errorf("%s: got tags %v, want %v", task.Name, task.Tags, want)
+		}
+		switch {
+		case task.Name == "base" && (task.Win_powershell == nil || task.Win_powershell.Script != parsed.Run["base"].script()):
+			t.Errorf("base: got %+v, want a win_powershell task running %q", task, parsed.Run["base"].script())
+		case task.Name != "base" && task.Debug == nil:
+			t.Errorf("%s has no command but is not a debug task", task.Name)
+		}
+	}
+}
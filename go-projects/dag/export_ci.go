@@ -0,0 +1,143 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Groupings of tasks into workflow jobs for --group
+const (
+	group_task  = "task"
+	group_level = "level"
+)
+
+// workflow_job is one job of a GitHub Actions workflow
+type workflow_job struct {
+	Name     string          `yaml:"name"`
+	Needs    []string        `yaml:"needs,omitempty"`
+	Runs_on  string          `yaml:"runs-on"`
+	Defaults map[string]any  `yaml:"defaults"`
+	Steps    []workflow_step `yaml:"steps"`
+}
+
+type workflow_step struct {
+	Name              string `yaml:"name"`
+	Continue_on_error bool   `yaml:"continue-on-error,omitempty"`
+	Run               string `yaml:"run"`
+}
+
+// export_github_actions renders a workflow with one job per task, or one per level when input.group is "level".
+// needs: follows the dependency lists, so the jobs run in the same order as dag run would start the tasks.
+// Every job starts on a fresh runner: the workflow checks that each command succeeds, not that the steps add up.
+// A failed job skips the jobs that need it and nothing else, which is the continue policy; the steps of
+// allow-failure tasks continue on error. Level jobs run one after another, so there a failure also stops every
+// later level, which is fail-fast. Per-task jobs cannot cancel each other, so fail-fast is rejected for them.
+func export_github_actions(input export_input) (string, error) {
+	jobs := &yaml.Node{Kind: yaml.MappingNode}
+	add_job := func(id string, job workflow_job) error {
+		var value yaml.Node
+		if err := value.Encode(job); err != nil {
+			return err
+		}
+		jobs.Content = append(jobs.Content, &yaml.Node{Kind: yaml.ScalarNode, Value: id}, &value)
+		return nil
+	}
+	new_job := func(name string, needs []string) workflow_job {
+		return workflow_job{
+			Name:     name,
+			Needs:    needs,
+			Runs_on:  "windows-latest",
+			Defaults: map[string]any{"run": map[string]string{"shell": "powershell"}},
+		}
+	}
+
+	switch input.group {
+	case group_task, "":
+		for _, task := range input.order {
+			if input.policy_of(task) == policy_fail_fast {
+				return "", fmt.Errorf("%s is fail-fast, but a failed job cannot cancel the others; use --group %s", task, group_level)
+			}
+		}
+		for _, task := range input.order {
+			job := new_job(task, input.target_names(input.sorted_dependencies(task)))
+			job.Steps = []workflow_step{task_step(input, task)}
+			if err := add_job(input.names[task], job); err != nil {
+				return "", err
+			}
+		}
+	case group_level:
+		levels := compute_levels(input.parsed.Dag)
+		by_level := make(map[int][]string)
+		var level_numbers []int
+		for _, task := range input.order {
+			if len(by_level[levels[task]]) == 0 {
+				level_numbers = append(level_numbers, levels[task])
+			}
+			by_level[levels[task]] = append(by_level[levels[task]], task)
+		}
+		for _, level := range level_numbers {
+			needs := make(map[int]bool)
+			var steps []workflow_step
+			for _, task := range by_level[level] {
+				for _, dep := range input.parsed.Dag[task] {
+					needs[levels[dep]] = true
+				}
+				steps = append(steps, task_step(input, task))
+			}
+			var need_ids []string
+			for need := range needs {
+				need_ids = append(need_ids, fmt.Sprintf("level-%d", need))
+			}
+			sort.Strings(need_ids)
+			job := new_job(fmt.Sprintf("Level %d", level), need_ids)
+			job.Steps = steps
+			if err := add_job(fmt.Sprintf("level-%d", level), job); err != nil {
+				return "", err
+			}
+		}
+	default:
+		return "", fmt.Errorf("unknown grouping %q (expected %s or %s)", input.group, group_task, group_level)
+	}
+
+	workflow := &yaml.Node{Kind: yaml.MappingNode}
+	add := func(key string, value *yaml.Node) {
+		workflow.Content = append(workflow.Content, &yaml.Node{Kind: yaml.ScalarNode, Value: key}, value)
+	}
+	scalar := func(value string) *yaml.Node {
+		return &yaml.Node{Kind: yaml.ScalarNode, Value: value}
+	}
+	triggers := &yaml.Node{Kind: yaml.MappingNode}
+	if err := triggers.Encode(map[string]any{
+		"push":              map[string][]string{"paths": {"dag.yaml"}},
+		"workflow_dispatch": map[string]any{},
+	}); err != nil {
+		return "", err
+	}
+	add("name", scalar("dag"))
+	add("on", triggers)
+	add("jobs", jobs)
+
+	var out strings.Builder
+	fmt.Fprintf(&out, "# Generated by dag export from %s. Do not edit; re-run dag export instead.\n", input.location)
+	encoder := yaml.NewEncoder(&out)
+	encoder.SetIndent(2)
+	if err := encoder.Encode(workflow); err != nil {
+		return "", err
+	}
+	if err := encoder.Close(); err != nil {
+		return "", err
+	}
+	return out.String(), nil
+}
+
+// task_step runs the command of task, or reports that it has none
+func task_step(input export_input, task string) workflow_step {
+	command := strings.TrimRight(input.parsed.Run[task].script(), "\r\n")
+	if command == "" {
+		command = "Write-Host " + powershell_quote(task+" has no command")
+	}
+	return workflow_step{Name: task, Continue_on_error: input.policy_of(task) == policy_allow_failure, Run: command}
+}
@@ -0,0 +1,213 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/PeterCullenBurbery/go_functions_002/v3/math_functions"
+)
+
+// export_powershell renders a standalone PowerShell script that runs every task in reverse topological order,
+// one at a time, with the failure policies of dag.yaml: a failure skips the dependents of the task, an
+// allow-failure task does not block them, and a fail-fast failure cancels every task after it.
+func export_powershell(input export_input) (string, error) {
+	order, err := math_functions.Reverse_topological_sort(input.parsed.Dag)
+	if err != nil {
+		return "", err
+	}
+
+	var out strings.Builder
+	fmt.Fprintf(&out, "# Generated by dag export from %s. Do not edit; re-run dag export instead.\n", input.location)
+	fmt.Fprintf(&out, "# Runs %d tasks in reverse topological order. Exits with 1 unless every task succeeded or was allowed to fail.\n\n", len(order))
+	out.WriteString(`$script:status = @{}      # task -> succeeded, failed, skipped or cancelled
+$script:blocked_by = @{}  # skipped or cancelled task -> the failed task that blocked it
+$script:allowed = @{}     # failed task -> $true if its policy is allow-failure
+$script:cancelled_by = '' # the fail-fast task whose failure cancelled the rest
+
+function Invoke-DagTask {
+    param([int]$Index, [string]$Name, [string[]]$Dependencies, [scriptblock]$Command, [string]$Policy = 'continue')
+
+    if ($script:cancelled_by) {
+        $script:status[$Name] = 'cancelled'
+        $script:blocked_by[$Name] = $script:cancelled_by
+        Write-Host "[$Index/$script:total] STOP $Name (cancelled by $script:cancelled_by)"
+        return
+    }
+    foreach ($dependency in $Dependencies) {
+        if ($script:status[$dependency] -ne 'succeeded' -and -not $script:allowed[$dependency]) {
+            $blocker = if ($script:status[$dependency] -eq 'skipped') { $script:blocked_by[$dependency] } else { $dependency }
+            $script:status[$Name] = 'skipped'
+            $script:blocked_by[$Name] = $blocker
+            Write-Host "[$Index/$script:total] SKIP $Name (blocked by $blocker)"
+            return
+        }
+    }
+
+    Write-Host "[$Index/$script:total] RUN  $Name"
+    $started = Get-Date
+    try {
+        $ErrorActionPreference = 'Stop'
+        $global:LASTEXITCODE = 0
+        & $Command
+        if ($LASTEXITCODE -ne 0) {
+            throw "exit code $LASTEXITCODE"
+        }
+        $script:status[$Name] = 'succeeded'
+        Write-Host "[$Index/$script:total] OK   $Name ($([int](((Get-Date) - $started).TotalMilliseconds)) ms)"
+    } catch {
+        $script:status[$Name] = 'failed'
+        if ($Policy -eq 'allow-failure') {
+            $script:allowed[$Name] = $true
+            Write-Host "[$Index/$script:total] FAIL $($Name): $_ (allowed to fail)"
+        } else {
+            Write-Host "[$Index/$script:total] FAIL $($Name): $_"
+        }
+        if ($Policy -eq 'fail-fast') {
+            $script:cancelled_by = $Name
+        }
+    }
+}
+
+`)
+	fmt.Fprintf(&out, "$script:total = %d\n", len(order))
+
+	for i, task := range order {
+		deps := make([]string, 0, len(input.parsed.Dag[task]))
+		for _, dep := range input.sorted_dependencies(task) {
+			deps = append(deps, powershell_quote(dep))
+		}
+		policy := ""
+		if input.policy_of(task) != policy_continue {
+			policy = " -Policy " + powershell_quote(input.policy_of(task))
+		}
+		fmt.Fprintf(&out, "\nInvoke-DagTask -Index %d -Name %s -Dependencies @(%s)%s -Command {\n",
+			i+1, powershell_quote(task), strings.Join(deps, ", "), policy)
+		for _, command_line := range command_lines(input.parsed.Run[task].script()) {
+			out.WriteString("    " + command_line + "\n")
+		}
+		out.WriteString("}\n")
+	}
+
+	out.WriteString(`
+$counts = $script:status.Values | Group-Object -NoElement | ForEach-Object { "$($_.Count) $($_.Name)" }
+Write-Host "Summary: $($counts -join ', ')"
+foreach ($task in $script:status.Keys) {
+    if ($script:status[$task] -ne 'succeeded' -and -not $script:allowed[$task]) {
+        exit 1
+    }
+}
+`)
+	return out.String(), nil
+}
+
+// export_bash renders a standalone bash script that runs every task in reverse topological order. Each command
+// runs in a subshell with set -e, and failures follow the policies of dag.yaml as in export_powershell.
+func export_bash(input export_input) (string, error) {
+	order, err := math_functions.Reverse_topological_sort(input.parsed.Dag)
+	if err != nil {
+		return "", err
+	}
+
+	var out strings.Builder
+	out.WriteString("#!/usr/bin/env bash\n")
+	fmt.Fprintf(&out, "# Generated by dag export from %s. Do not edit; re-run dag export instead.\n", input.location)
+	fmt.Fprintf(&out, "# Runs %d tasks in reverse topological order. Exits with 1 unless every task succeeded or was allowed to fail.\n", len(order))
+	out.WriteString("# Needs bash 4 or later for associative arrays.\n\n")
+	fmt.Fprintf(&out, "total=%d\n", len(order))
+	out.WriteString(`declare -A status=()      # task -> succeeded, failed, skipped or cancelled
+declare -A blocked_by=()  # skipped or cancelled task -> the failed task that blocked it
+declare -A allowed=()     # failed task -> 1 if its policy is allow-failure
+cancelled_by=""           # the fail-fast task whose failure cancelled the rest
+
+# run_task INDEX NAME FUNCTION POLICY [DEPENDENCY...]
+run_task() {
+    local index=$1 name=$2 function=$3 policy=$4
+    shift 4
+    if [[ -n $cancelled_by ]]; then
+        status[$name]=cancelled
+        blocked_by[$name]=$cancelled_by
+        echo "[$index/$total] STOP $name (cancelled by $cancelled_by)"
+        return
+    fi
+    local dependency blocker
+    for dependency in "$@"; do
+        if [[ "${status[$dependency]:-}" != succeeded && -z "${allowed[$dependency]:-}" ]]; then
+            if [[ "${status[$dependency]:-}" == skipped ]]; then
+                blocker=${blocked_by[$dependency]}
+            else
+                blocker=$dependency
+            fi
+            status[$name]=skipped
+            blocked_by[$name]=$blocker
+            echo "[$index/$total] SKIP $name (blocked by $blocker)"
+            return
+        fi
+    done
+
+    echo "[$index/$total] RUN  $name"
+    local started=$SECONDS
+    ( set -e; "$function" )
+    local code=$?
+    if [[ $code -eq 0 ]]; then
+        status[$name]=succeeded
+        echo "[$index/$total] OK   $name ($((SECONDS - started)) s)"
+    else
+        status[$name]=failed
+        if [[ $policy == allow-failure ]]; then
+            allowed[$name]=1
+            echo "[$index/$total] FAIL $name: exit code $code (allowed to fail)"
+        else
+            echo "[$index/$total] FAIL $name: exit code $code"
+        fi
+        if [[ $policy == fail-fast ]]; then
+            cancelled_by=$name
+        fi
+    fi
+}
+`)
+
+	for i, task := range order {
+		function := fmt.Sprintf("task_%d", i+1)
+		fmt.Fprintf(&out, "\n# %s\n%s() {\n", task, function)
+		lines := command_lines(input.parsed.Run[task].script_quoted(bash_quote))
+		if len(lines) == 0 {
+			lines = []string{":"}
+		}
+		for _, command_line := range lines {
+			out.WriteString("    " + command_line + "\n")
+		}
+		out.WriteString("}\n")
+		args := []string{fmt.Sprint(i + 1), bash_quote(task), function, input.policy_of(task)}
+		for _, dep := range input.sorted_dependencies(task) {
+			args = append(args, bash_quote(dep))
+		}
+		fmt.Fprintf(&out, "run_task %s\n", strings.Join(args, " "))
+	}
+
+	out.WriteString(`
+summary=""
+for outcome in succeeded failed skipped cancelled; do
+    count=0
+    for task in "${!status[@]}"; do
+        [[ ${status[$task]} == "$outcome" ]] && count=$((count + 1))
+    done
+    summary+="$count $outcome, "
+done
+echo "Summary: ${summary%, }"
+for task in "${!status[@]}"; do
+    [[ ${status[$task]} != succeeded && -z "${allowed[$task]:-}" ]] && exit 1
+done
+exit 0
+`)
+	return out.String(), nil
+}
+
+// powershell_quote renders s as a single-quoted PowerShell string
+func powershell_quote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", "''") + "'"
+}
+
+// bash_quote renders s as a single-quoted bash word
+func bash_quote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
@@ -0,0 +1,367 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"gopkg.in/yaml.v3"
+)
+
+// rename_graph maps a graph of sanitised target names back to task names, dropping targets that are not tasks
+func rename_graph(graph map[string][]string, names map[string]string) map[string][]string {
+	tasks := make(map[string]string, len(names))
+	for task, name := range names {
+		tasks[name] = task
+	}
+	renamed := make(map[string][]string)
+	for target, prerequisites := range graph {
+		task, ok := tasks[target]
+		if !ok {
+			continue
+		}
+		deps := []string{}
+		for _, prerequisite := range prerequisites {
+			if dep, ok := tasks[prerequisite]; ok {
+				deps = append(deps, dep)
+			} else {
+				deps = append(deps, prerequisite)
+			}
+		}
+		renamed[task] = deps
+	}
+	return renamed
+}
+
+// Test_export_make_round_trip parses the prerequisites of the generated Makefile back into the graph it came from
+func Test_export_make_round_trip(t *testing.T) {
+	content, err := os.ReadFile("dag.yaml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	embedded, err := parse_dag_file(content, "dag.yaml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	awkward := dag_file{
+		Dag: map[string][]string{
+			"all":             {},            // clashes with the aggregate target
+			"build app":       {"all"},       // renamed to build-app
+			"build-app":       {},            // clashes with the rename above
+			"2fa: setup":      {"build app"}, // starts with a digit and contains a colon
+			"x # y":           {"2fa: setup", "build-app"},
+			"install $(PATH)": {"x # y"},
+		},
+		Run: map[string]task_command{
+			"x # y": {Kind: kind_shell, Argument: "echo $HOME: done # not a prerequisite"},
+		},
+	}
+
+	for name, parsed := range map[string]dag_file{"dag.yaml": embedded, "awkward names": awkward} {
+		t.Run(name, func(t *testing.T) {
+			input := new_export_input(parsed, "dag.yaml")
+			makefile, err := export_make(input)
+			if err != nil {
+				t.Fatal(err)
+			}
+			reparsed, err := parse_make_prerequisites(makefile)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if diff := diff_graphs(parsed.Dag, rename_graph(reparsed, input.names)); diff != "" {
+				t.Errorf("generated Makefile does not round-trip: %s\n%s", diff, makefile)
+			}
+		})
+	}
+}
+
+// Test_export_bash_policies runs the generated bash script and checks that it applies the failure policies
+func Test_export_bash_policies(t *testing.T) {
+	if _, err := exec.LookPath("bash"); err != nil {
+		t.Skip("bash is not installed")
+	}
+	tests := []struct {
+		name      string
+		parsed    dag_file
+		want      []string // lines of the output
+		want_exit int
+	}{
+		{
+			name: "allow-failure",
+			parsed: dag_file{
+				Dag:    map[string][]string{"a": {}, "b": {"a"}},
+				Run:    map[string]task_command{"a": {Kind: kind_shell, Argument: "exit 3"}, "b": {Kind: kind_shell, Argument: "echo b ran"}},
+				Policy: map[string]string{"a": policy_allow_failure},
+			},
+			want:      []string{"FAIL a: exit code 3 (allowed to fail)", "b ran"},
+			want_exit: 0,
+		},
+		{
+			name: "continue",
+			parsed: dag_file{
+				Dag: map[string][]string{"c": {}, "d": {"c"}, "g": {}},
+				Run: map[string]task_command{"c": {Kind: kind_shell, Argument: "exit 4"}, "g": {Kind: kind_shell, Argument: "echo g ran"}},
+			},
+			want:      []string{"FAIL c: exit code 4", "SKIP d (blocked by c)", "g ran"},
+			want_exit: 1,
+		},
+		{
+			name: "fail-fast",
+			parsed: dag_file{
+				Dag:    map[string][]string{"x": {}, "y": {"x"}, "z": {"y"}},
+				Run:    map[string]task_command{"x": {Kind: kind_shell, Argument: "exit 5"}, "z": {Kind: kind_shell, Argument: "echo z ran"}},
+				Policy: map[string]string{"x": policy_fail_fast},
+			},
+			want:      []string{"FAIL x: exit code 5", "STOP y (cancelled by x)", "STOP z (cancelled by x)"},
+			want_exit: 1,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			script, err := export_bash(new_export_input(test.parsed, "dag.yaml"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			path := filepath.Join(t.TempDir(), "dag.sh")
+			if err := os.WriteFile(path, []byte(script), 0o755); err != nil {
+				t.Fatal(err)
+			}
+			output, err := exec.Command("bash", path).CombinedOutput()
+			exit := 0
+			var exit_error *exec.ExitError
+			if errors.As(err, &exit_error) {
+				exit = exit_error.ExitCode()
+			} else if err != nil {
+				t.Fatal(err)
+			}
+			if exit != test.want_exit {
+				t.Errorf("exit code %d, want %d\n%s", exit, test.want_exit, output)
+			}
+			for _, line := range test.want {
+				if !strings.Contains(string(output), line) {
+					t.Errorf("output lacks %q:\n%s", line, output)
+				}
+			}
+			if strings.Contains(string(output), "z ran") {
+				t.Errorf("a task ran after the fail-fast failure:\n%s", output)
+			}
+		})
+	}
+}
+
+func Test_export_policies(t *testing.T) {
+	parsed := dag_file{
+		Dag:    map[string][]string{"flaky": {}, "strict": {"flaky"}},
+		Run:    map[string]task_command{"flaky": {Kind: kind_shell, Argument: "Get-Flaky"}, "strict": {Kind: kind_shell, Argument: "Get-Strict"}},
+		Policy: map[string]string{"flaky": policy_allow_failure, "strict": policy_fail_fast},
+	}
+	input := new_export_input(parsed, "dag.yaml")
+	tests := []struct {
+		format string
+		group  string
+		want   []string
+		ignore string // marks the one command that may fail
+	}{
+		{"make", "", []string{"\t-Get-Flaky\n", "\tGet-Strict\n"}, "\t-"},
+		{"just", "", []string{"\n    -Get-Flaky\n", "\n    Get-Strict\n"}, "    -"},
+		{"taskfile", "", []string{"- cmd: Get-Flaky\n        ignore_error: true\n", "- Get-Strict\n"}, "ignore_error"},
+		{"github-actions", group_level, []string{"- name: flaky\n        continue-on-error: true\n", "- name: strict\n        run: Get-Strict\n"}, "continue-on-error"},
+		{"powershell", "", []string{"-Name 'flaky' -Dependencies @() -Policy 'allow-failure' -Command", "-Policy 'fail-fast'"}, "-Policy 'allow-failure'"},
+		{"ansible", "", []string{"ignore_errors: true"}, "ignore_errors"},
+	}
+	for _, test := range tests {
+		input.group = test.group
+		content, err := exporters[test.format](input)
+		if err != nil {
+			t.Fatalf("%s: %v", test.format, err)
+		}
+		for _, want := range test.want {
+			if !strings.Contains(content, want) {
+				t.Errorf("%s: output lacks %q:\n%s", test.format, want, content)
+			}
+		}
+		if strings.Count(content, test.ignore) != 1 {
+			t.Errorf("%s: only flaky may ignore errors:\n%s", test.format, content)
+		}
+	}
+
+	// A failed job cannot cancel the jobs that do not need it
+	input.group = group_task
+	if _, err := export_github_actions(input); err == nil || !strings.Contains(err.Error(), "strict is fail-fast") {
+		t.Errorf("github-actions per task: error %v, want strict rejected as fail-fast", err)
+	}
+	parsed.Policy = map[string]string{"flaky": policy_allow_failure}
+	content, err := export_github_actions(new_export_input(parsed, "dag.yaml"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(content, "- name: flaky\n        continue-on-error: true\n") {
+		t.Errorf("github-actions per task: flaky does not continue on error:\n%s", content)
+	}
+}
+
+// export_fixture is a diamond with names the formats have to sanitise and commands they have to escape
+var export_fixture = dag_file{
+	Dag: map[string][]string{
+		"fetch sources": {},
+		"build app":     {"fetch sources"},
+		"build docs":    {"fetch sources"},
+		"release":       {"build app", "build docs"},
+	},
+	Run: map[string]task_command{
+		"fetch sources": {Kind: kind_shell, Argument: "git fetch"},
+		"build app":     {Kind: kind_shell, Argument: "go build ./...\n\ngo vet ./...\necho {{version}}\n"},
+		"release":       {Kind: kind_shell, Argument: "echo released"},
+	},
+}
+
+// Test_export_golden compares the output of each format for export_fixture with testdata/export;
+// go test -run Test_export_golden -update rewrites the files
+func Test_export_golden(t *testing.T) {
+	tests := []struct {
+		golden string
+		format string
+		group  string
+	}{
+		{"just", "just", ""},
+		{"taskfile", "taskfile", ""},
+		{"github-actions", "github-actions", group_task},
+		{"github-actions-level", "github-actions", group_level},
+	}
+	for _, test := range tests {
+		t.Run(test.golden, func(t *testing.T) {
+			input := new_export_input(export_fixture, "dag.yaml")
+			input.group = test.group
+			content, err := exporters[test.format](input)
+			if err != nil {
+				t.Fatal(err)
+			}
+			compare_golden_file(t, filepath.Join("testdata", "export", test.golden+".golden"), content)
+		})
+	}
+}
+
+// just_recipes reads the recipe headers of a justfile as recipe -> dependencies
+func just_recipes(content string) map[string][]string {
+	recipes := make(map[string][]string)
+	for _, line := range strings.Split(content, "\n") {
+		if line == "" || strings.HasPrefix(line, " ") || strings.HasPrefix(line, "#") || strings.HasPrefix(line, "set ") {
+			continue
+		}
+		name, deps, _ := strings.Cut(line, ":")
+		recipes[name] = strings.Fields(deps)
+	}
+	return recipes
+}
+
+func Test_export_just(t *testing.T) {
+	input := new_export_input(export_fixture, "dag.yaml")
+	content, err := export_just(input)
+	if err != nil {
+		t.Fatal(err)
+	}
+	recipes := just_recipes(content)
+	if diff := diff_graphs(export_fixture.Dag, rename_graph(recipes, input.names)); diff != "" {
+		t.Errorf("recipes do not match the graph: %s\n%s", diff, content)
+	}
+	if !reflect.DeepEqual(recipes["default"], []string{"release"}) {
+		t.Errorf("default depends on %q, want the root release", recipes["default"])
+	}
+	for _, want := range []string{"\n    go build ./...\n    go vet ./...\n", "echo {{{{version}}\n"} {
+		if !strings.Contains(content, want) {
+			t.Errorf("justfile lacks %q:\n%s", want, content)
+		}
+	}
+}
+
+func Test_export_taskfile(t *testing.T) {
+	input := new_export_input(export_fixture, "dag.yaml")
+	content, err := export_taskfile(input)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var file taskfile
+	if err := yaml.Unmarshal([]byte(content), &file); err != nil {
+		t.Fatal(err)
+	}
+
+	graph := make(map[string][]string)
+	for name, task := range file.Tasks {
+		graph[name] = task.Deps
+		// go-task runs a dependency once per dependent unless told otherwise; fetch sources is shared
+		if task.Run != "once" {
+			t.Errorf("%s: run %q, want once", name, task.Run)
+		}
+	}
+	if diff := diff_graphs(export_fixture.Dag, rename_graph(graph, input.names)); diff != "" {
+		t.Errorf("deps do not match the graph: %s\n%s", diff, content)
+	}
+	if got := file.Tasks["build-app"].Cmds; !reflect.DeepEqual(got, []taskfile_command{{Cmd: "go build ./...\n\ngo vet ./...\necho {{\"{{\"}}version}}\n"}}) {
+		t.Errorf("build-app cmds %+v, want the command with {{ escaped for Go templates", got)
+	}
+	if file.Tasks["release"].Desc != "release" || file.Tasks["fetch-sources"].Desc != "fetch sources" {
+		t.Errorf("descriptions do not name the tasks:\n%s", content)
+	}
+}
+
+// Test_export_github_actions_needs checks that a job starts only after the jobs of all its dependencies
+func Test_export_github_actions_needs(t *testing.T) {
+	// publish skips a level: its level job has to need level 1 as well as level 3
+	parsed := dag_file{Dag: map[string][]string{"publish": {"release", "fetch sources"}}}
+	for task, deps := range export_fixture.Dag {
+		parsed.Dag[task] = deps
+	}
+	levels := compute_levels(parsed.Dag)
+
+	for _, group := range []string{group_task, group_level} {
+		t.Run(group, func(t *testing.T) {
+			input := new_export_input(parsed, "dag.yaml")
+			input.group = group
+			content, err := export_github_actions(input)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var workflow struct {
+				Jobs map[string]workflow_job `yaml:"jobs"`
+			}
+			if err := yaml.Unmarshal([]byte(content), &workflow); err != nil {
+				t.Fatal(err)
+			}
+
+			if group == group_task {
+				graph := make(map[string][]string)
+				for id, job := range workflow.Jobs {
+					graph[id] = job.Needs
+				}
+				if diff := diff_graphs(parsed.Dag, rename_graph(graph, input.names)); diff != "" {
+					t.Errorf("needs do not match the graph: %s\n%s", diff, content)
+				}
+				return
+			}
+
+			want := map[string][]string{
+				"level-1": nil,
+				"level-2": {"level-1"},
+				"level-3": {"level-2"},
+				"level-4": {"level-1", "level-3"},
+			}
+			got := make(map[string][]string)
+			for id, job := range workflow.Jobs {
+				got[id] = job.Needs
+				for _, step := range job.Steps {
+					if want := fmt.Sprintf("level-%d", levels[step.Name]); id != want {
+						t.Errorf("%s runs in %s, want %s", step.Name, id, want)
+					}
+				}
+			}
+			if !reflect.DeepEqual(got, want) {
+				t.Errorf("needs %v, want %v\n%s", got, want, content)
+			}
+		})
+	}
+}
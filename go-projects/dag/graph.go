@@ -0,0 +1,222 @@
+package main
+
+import (
+	"sort"
+
+	"github.com/PeterCullenBurbery/go_functions_002/v3/math_functions"
+)
+
+// compute_levels calculates the level of each node using DFS + memoization
+func compute_levels(dag map[string][]string) map[string]int {
+	cache := make(map[string]int)
+
+	var level_of func(string) int
+	level_of = func(task string) int {
+		if lvl, ok := cache[task]; ok {
+			return lvl
+		}
+		deps := dag[task]
+		if len(deps) == 0 {
+			cache[task] = 1
+			return 1
+		}
+		max_level := 0
+		for _, dep := range deps {
+			l := level_of(dep)
+			if l > max_level {
+				max_level = l
+			}
+		}
+		cache[task] = max_level + 1
+		return cache[task]
+	}
+
+	for task := range dag {
+		level_of(task)
+	}
+
+	return cache
+}
+
+// resolve_all_dependencies returns the full transitive dependency list for a task
+func resolve_all_dependencies(task string, dag map[string][]string) []string {
+	seen := make(map[string]bool)
+	var visit func(string)
+	visit = func(t string) {
+		for _, dep := range dag[t] {
+			if !seen[dep] {
+				seen[dep] = true
+				visit(dep)
+			}
+		}
+	}
+	visit(task)
+
+	var result []string
+	for dep := range seen {
+		result = append(result, dep)
+	}
+	sort.Strings(result)
+	return result
+}
+
+// build_reverse_graph returns a map of dependency -> list of tasks that depend on it directly
+func build_reverse_graph(dag map[string][]string) map[string][]string {
+	reverse := make(map[string][]string)
+	for task, deps := range dag {
+		for _, dep := range deps {
+			reverse[dep] = append(reverse[dep], task)
+		}
+	}
+	for _, dependents := range reverse {
+		sort.Strings(dependents)
+	}
+	return reverse
+}
+
+// Distance modes decide the level of a dependent that is reachable over paths of different lengths
+const (
+	distance_shortest = "shortest" // nearest distance wins
+	distance_longest  = "longest"  // deeper beats shallow
+	distance_all      = "all"      // listed once for every distinct distance
+)
+
+// dependents_by_distance returns map[node] -> map[distance] -> sorted list of the node's transitive dependents,
+// placing each dependent according to mode
+func dependents_by_distance(dag map[string][]string, mode string) map[string]map[int][]string {
+	reverse := build_reverse_graph(dag)
+
+	// cache[node][dependent] = set of distances at which dependent is reachable from node
+	cache := make(map[string]map[string]map[int]bool)
+
+	var visit func(string) map[string]map[int]bool
+	visit = func(node string) map[string]map[int]bool {
+		if cached, ok := cache[node]; ok {
+			return cached
+		}
+		distances := make(map[string]map[int]bool)
+		add := func(dependent string, distance int) {
+			if distances[dependent] == nil {
+				distances[dependent] = make(map[int]bool)
+			}
+			distances[dependent][distance] = true
+		}
+		for _, dependent := range reverse[node] {
+			add(dependent, 1)
+			for sub, sub_distances := range visit(dependent) {
+				for d := range sub_distances {
+					add(sub, d+1)
+				}
+			}
+		}
+		cache[node] = distances
+		return distances
+	}
+
+	result := make(map[string]map[int][]string)
+	for node := range dag {
+		bylvl := make(map[int][]string)
+		for dependent, distances := range visit(node) {
+			shortest, longest := -1, -1
+			for d := range distances {
+				if mode == distance_all {
+					bylvl[d] = append(bylvl[d], dependent)
+				}
+				if shortest < 0 || d < shortest {
+					shortest = d
+				}
+				if d > longest {
+					longest = d
+				}
+			}
+			switch mode {
+			case distance_shortest:
+				bylvl[shortest] = append(bylvl[shortest], dependent)
+			case distance_longest:
+				bylvl[longest] = append(bylvl[longest], dependent)
+			}
+		}
+		for _, level := range bylvl {
+			sort.Strings(level)
+		}
+		result[node] = bylvl
+	}
+	return result
+}
+
+// sorted_tasks returns the tasks of the DAG in lexical order
+func sorted_tasks(dag map[string][]string) []string {
+	tasks := make([]string, 0, len(dag))
+	for task := range dag {
+		tasks = append(tasks, task)
+	}
+	sort.Strings(tasks)
+	return tasks
+}
+
+// check_dag reports dependencies that are not tasks of the DAG as *ErrUnknownDependency, and cycles as *ErrCycle
+func check_dag(dag map[string][]string) error {
+	for _, task := range sorted_tasks(dag) {
+		for _, dep := range dag[task] {
+			if _, ok := dag[dep]; !ok {
+				return &ErrUnknownDependency{Task: task, Dependency: dep}
+			}
+		}
+	}
+	if cycle := find_cycle(dag); cycle != nil {
+		return &ErrCycle{Path: cycle}
+	}
+	return nil
+}
+
+// find_cycle returns the first dependency cycle found by DFS, starting and ending with the same task, or nil
+func find_cycle(dag map[string][]string) []string {
+	const (
+		unvisited = iota
+		in_progress
+		done
+	)
+	state := make(map[string]int)
+	var stack []string
+
+	var visit func(string) []string
+	visit = func(task string) []string {
+		state[task] = in_progress
+		stack = append(stack, task)
+		for _, dep := range dag[task] {
+			switch state[dep] {
+			case in_progress:
+				for i, t := range stack {
+					if t == dep {
+						return append(append([]string{}, stack[i:]...), dep)
+					}
+				}
+			case unvisited:
+				if cycle := visit(dep); cycle != nil {
+					return cycle
+				}
+			}
+		}
+		stack = stack[:len(stack)-1]
+		state[task] = done
+		return nil
+	}
+
+	for _, task := range sorted_tasks(dag) {
+		if state[task] == unvisited {
+			if cycle := visit(task); cycle != nil {
+				return cycle
+			}
+		}
+	}
+	return nil
+}
+
+// plan_order returns the selected tasks in reverse topological order, dependencies first
+func plan_order(selected map[string]bool, dag map[string][]string) ([]string, error) {
+	subgraph := make(map[string][]string)
+	for task := range selected {
+		subgraph[task] = dag[task]
+	}
+	return math_functions.Reverse_topological_sort(subgraph)
+}
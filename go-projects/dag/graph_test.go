@@ -0,0 +1,39 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+// diamond_dag is a diamond with a shortcut: top reaches base over left, over right and directly
+var diamond_dag = map[string][]string{
+	"base":  {},
+	"left":  {"base"},
+	"right": {"base"},
+	"top":   {"left", "right", "base"},
+}
+
+func Test_dependents_by_distance(t *testing.T) {
+	tests := []struct {
+		mode string
+		want map[int][]string
+	}{
+		{distance_shortest, map[int][]string{1: {"left", "right", "top"}}},
+		{distance_longest, map[int][]string{1: {"left", "right"}, 2: {"top"}}},
+		{distance_all, map[int][]string{1: {"left", "right", "top"}, 2: {"top"}}},
+	}
+	for _, test := range tests {
+		t.Run(test.mode, func(t *testing.T) {
+			got := dependents_by_distance(diamond_dag, test.mode)
+			if !reflect.DeepEqual(got["base"], test.want) {
+				t.Errorf("dependents of base = %v, want %v", got["base"], test.want)
+			}
+			if want := map[int][]string{1: {"top"}}; !reflect.DeepEqual(got["left"], want) {
+				t.Errorf("dependents of left = %v, want %v", got["left"], want)
+			}
+			if len(got["top"]) != 0 {
+				t.Errorf("dependents of top = %v, want none", got["top"])
+			}
+		})
+	}
+}
@@ -0,0 +1,336 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"log/slog"
+	"math"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+)
+
+// history_path is the append-only run history file; empty disables recording. Writers hold an exclusive and
+// readers a shared lock on it, so that runs in several processes never interleave or read half-written lines.
+var history_path string
+
+// history_record is one finished task of one run, stored as a line of JSON
+type history_record struct {
+	Run         string  `json:"run"`
+	Task        string  `json:"task"`
+	Status      string  `json:"status"`
+	Started_at  string  `json:"started_at"`
+	Finished_at string  `json:"finished_at"`
+	Duration_ms float64 `json:"duration_ms"`
+	Error       string  `json:"error,omitempty"`
+	Blocked_by  string  `json:"blocked_by,omitempty"`
+}
+
+// task_stats summarises the history of one task
+type task_stats struct {
+	Task         string  `json:"task"`
+	Runs         int     `json:"runs"`    // succeeded + failed
+	Skipped      int     `json:"skipped"` // runs where a dependency failed or a fail-fast failure cancelled the task
+	Succeeded    int     `json:"succeeded"`
+	Success_rate float64 `json:"success_rate"`
+	Median_ms    float64 `json:"median_ms"`
+	P95_ms       float64 `json:"p95_ms"`
+	Last_status  string  `json:"last_status"`
+	Last_run_at  string  `json:"last_run_at"`
+}
+
+// history_recorder appends task_finished events of a single run to the history file
+type history_recorder struct {
+	run   string
+	path  string
+	mutex sync.Mutex
+}
+
+// add_history_flags registers the flag that locates the run history
+func add_history_flags(flags *flag.FlagSet) {
+	flags.StringVar(&history_path, "history", default_history_path(), "run history file (empty to disable)")
+}
+
+// default_history_path returns history.jsonl inside the user cache directory, next to the cached dag.yaml
+func default_history_path() string {
+	cache_root, err := os.UserCacheDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(cache_root, "dag", "history.jsonl")
+}
+
+// new_history_recorder returns a recorder for a new run, or nil when history is disabled
+func new_history_recorder() *history_recorder {
+	if history_path == "" {
+		return nil
+	}
+	return &history_recorder{
+		run:  time.Now().UTC().Format("20060102T150405.000Z"),
+		path: history_path,
+	}
+}
+
+// record appends event to the history if it reports a finished task; safe for concurrent use
+func (recorder *history_recorder) record(event run_event) {
+	if recorder == nil || event.Type != event_task_finished {
+		return
+	}
+	finished, err := time.Parse(time.RFC3339Nano, event.Time)
+	if err != nil {
+		finished = time.Now()
+	}
+	duration := time.Duration(event.Duration_ms * float64(time.Millisecond))
+	line, err := json.Marshal(history_record{
+		Run:         recorder.run,
+		Task:        event.Task,
+		Status:      event.Status,
+		Started_at:  finished.Add(-duration).Format(time.RFC3339Nano),
+		Finished_at: finished.Format(time.RFC3339Nano),
+		Duration_ms: event.Duration_ms,
+		Error:       event.Error,
+		Blocked_by:  event.Blocked_by,
+	})
+	if err != nil {
+		return
+	}
+
+	recorder.mutex.Lock()
+	defer recorder.mutex.Unlock()
+	if err := os.MkdirAll(filepath.Dir(recorder.path), 0o755); err != nil {
+		slog.Warn("history_write_failed", "error", err)
+		return
+	}
+	if err := append_history_line(recorder.path, line); err != nil {
+		slog.Warn("history_write_failed", "error", err)
+	}
+}
+
+// append_history_line appends line to the history file under an exclusive lock. A last line cut short by a
+// crash is dropped first, so that it does not swallow the new record.
+func append_history_line(path string, line []byte) error {
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_RDWR|os.O_APPEND, 0o644)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	if err := acquire_file_lock(file, true); err != nil {
+		return err
+	}
+	defer release_file_lock(file)
+
+	info, err := file.Stat()
+	if err != nil {
+		return err
+	}
+	complete, err := complete_lines_size(file, info.Size())
+	if err != nil {
+		return err
+	}
+	if complete < info.Size() {
+		slog.Warn("history_line_truncated", "path", path, "dropped_bytes", info.Size()-complete)
+		if err := file.Truncate(complete); err != nil {
+			return err
+		}
+	}
+	_, err = file.Write(append(line, '\n'))
+	return err
+}
+
+// complete_lines_size returns the length of the first size bytes of file up to and including the last newline
+func complete_lines_size(file *os.File, size int64) (int64, error) {
+	block := make([]byte, 4096)
+	for end := size; end > 0; {
+		start := max(end-int64(len(block)), 0)
+		n, err := file.ReadAt(block[:end-start], start)
+		if err != nil {
+			return 0, err
+		}
+		if i := bytes.LastIndexByte(block[:n], '\n'); i >= 0 {
+			return start + int64(i) + 1, nil
+		}
+		end = start
+	}
+	return 0, nil
+}
+
+// load_history reads every record of the history file, oldest first; a missing file is an empty history.
+// A line without a trailing newline was cut short by a crash and is skipped when it does not parse.
+func load_history(path string) ([]history_record, error) {
+	file, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	if err := acquire_file_lock(file, false); err != nil {
+		return nil, err
+	}
+	defer release_file_lock(file)
+
+	var records []history_record
+	reader := bufio.NewReader(file)
+	line_number := 0
+	for {
+		line, read_err := reader.ReadBytes('\n')
+		if read_err != nil && read_err != io.EOF {
+			return nil, read_err
+		}
+		line_number++
+		terminated := bytes.HasSuffix(line, []byte("\n"))
+		if line = bytes.TrimSpace(line); len(line) > 0 {
+			var record history_record
+			err := json.Unmarshal(line, &record)
+			switch {
+			case err == nil:
+				records = append(records, record)
+			case terminated:
+				return nil, fmt.Errorf("%s line %d: %w", path, line_number, err)
+			default:
+				slog.Warn("history_line_truncated", "path", path, "line", line_number)
+			}
+		}
+		if read_err == io.EOF {
+			return records, nil
+		}
+	}
+}
+
+// compute_task_stats summarises records per task
+func compute_task_stats(records []history_record) map[string]task_stats {
+	durations := make(map[string][]float64)
+	latest := make(map[string]time.Time) // Finished_at of Last_status; the strings do not sort with time zones or fractions
+	stats := make(map[string]task_stats)
+	for _, record := range records {
+		stat := stats[record.Task]
+		stat.Task = record.Task
+		switch record.Status {
+		case status_skipped, status_cancelled:
+			stat.Skipped++
+		case status_succeeded:
+			stat.Succeeded++
+			stat.Runs++
+			durations[record.Task] = append(durations[record.Task], record.Duration_ms)
+		default:
+			stat.Runs++
+			durations[record.Task] = append(durations[record.Task], record.Duration_ms)
+		}
+		finished, err := time.Parse(time.RFC3339Nano, record.Finished_at)
+		if err != nil {
+			slog.Debug("history_time_invalid", "task", record.Task, "finished_at", record.Finished_at)
+		}
+		// On a tie the later record wins, as the history is appended in order
+		if stat.Last_run_at == "" || !latest[record.Task].After(finished) {
+			latest[record.Task] = finished
+			stat.Last_run_at = record.Finished_at
+			stat.Last_status = record.Status
+		}
+		stats[record.Task] = stat
+	}
+
+	for task, stat := range stats {
+		if stat.Runs > 0 {
+			stat.Success_rate = float64(stat.Succeeded) / float64(stat.Runs)
+		}
+		values := durations[task]
+		sort.Float64s(values)
+		stat.Median_ms = percentile(values, 50)
+		stat.P95_ms = percentile(values, 95)
+		stats[task] = stat
+	}
+	return stats
+}
+
+// percentile returns the p-th percentile of sorted values using the nearest-rank method
+func percentile(sorted []float64, p float64) float64 {
+	if len(sorted) == 0 {
+		return 0
+	}
+	rank := int(math.Ceil(p / 100 * float64(len(sorted))))
+	if rank < 1 {
+		rank = 1
+	}
+	return sorted[rank-1]
+}
+
+// run_history prints the most recent history records, newest first
+func run_history(args []string) {
+	flags := flag.NewFlagSet("history", flag.ExitOnError)
+	add_logging_flags(flags)
+	task := flags.String("task", "", "only show this task")
+	limit := flags.Int("limit", 20, "number of records to show (0 for all)")
+	add_history_flags(flags)
+	flags.Parse(args)
+
+	records, err := load_history(history_path)
+	if err != nil {
+		fatal("history_read_failed", "error", err)
+	}
+
+	icons := map[string]string{status_succeeded: "✅", status_failed: "❌", status_skipped: "⏭️", status_cancelled: "🛑"}
+	fmt.Println("🕘 run history:")
+	shown := 0
+	for i := len(records) - 1; i >= 0 && (*limit == 0 || shown < *limit); i-- {
+		record := records[i]
+		if *task != "" && record.Task != *task {
+			continue
+		}
+		shown++
+		line := fmt.Sprintf("  %s %s  %s  %s (%s)", icons[record.Status], record.Finished_at, record.Run,
+			record.Task, format_ms(record.Duration_ms))
+		switch {
+		case record.Error != "":
+			line += ": " + record.Error
+		case record.Blocked_by != "":
+			line += " blocked by " + record.Blocked_by
+		}
+		fmt.Println(line)
+	}
+	if shown == 0 {
+		fmt.Println("  (no runs recorded)")
+	}
+}
+
+// run_stats prints per-task success rate, duration percentiles and last outcome
+func run_stats(args []string) {
+	flags := flag.NewFlagSet("stats", flag.ExitOnError)
+	add_logging_flags(flags)
+	add_history_flags(flags)
+	flags.Parse(args)
+
+	records, err := load_history(history_path)
+	if err != nil {
+		fatal("history_read_failed", "error", err)
+	}
+	stats := compute_task_stats(records)
+
+	var tasks []string
+	for task := range stats {
+		tasks = append(tasks, task)
+	}
+	sort.Strings(tasks)
+
+	fmt.Println("📈 task statistics:")
+	for _, task := range tasks {
+		stat := stats[task]
+		fmt.Printf("  - %s: %d run(s), %.0f%% succeeded, median %s, p95 %s, %d skipped, last %s at %s\n",
+			task, stat.Runs, stat.Success_rate*100, format_ms(stat.Median_ms), format_ms(stat.P95_ms),
+			stat.Skipped, stat.Last_status, stat.Last_run_at)
+	}
+	if len(tasks) == 0 {
+		fmt.Println("  (no runs recorded)")
+	}
+}
+
+// format_ms renders a duration in milliseconds the way the runner prints durations
+func format_ms(ms float64) string {
+	return time.Duration(ms * float64(time.Millisecond)).Round(time.Millisecond).String()
+}
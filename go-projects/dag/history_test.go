@@ -0,0 +1,157 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// use_test_history points history_path at a file in a fresh temporary directory
+func use_test_history(t *testing.T) string {
+	t.Helper()
+	saved := history_path
+	t.Cleanup(func() { history_path = saved })
+	history_path = filepath.Join(t.TempDir(), "dag", "history.jsonl")
+	return history_path
+}
+
+func Test_history_round_trip(t *testing.T) {
+	path := use_test_history(t)
+	recorder := new_history_recorder()
+	recorder.record(run_event{Type: event_task_started, Task: "a"})
+	recorder.record(run_event{Type: event_task_finished, Task: "a", Status: status_succeeded, Time: "2026-01-01T09:00:01.5Z", Duration_ms: 1500})
+	recorder.record(run_event{Type: event_task_finished, Task: "b", Status: status_failed, Time: "2026-01-01T09:00:02Z", Error: "exit status 1"})
+	recorder.record(run_event{Type: event_task_finished, Task: "c", Status: status_skipped, Time: "2026-01-01T09:00:02Z", Blocked_by: "b"})
+
+	records, err := load_history(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []history_record{
+		{Task: "a", Status: status_succeeded, Started_at: "2026-01-01T09:00:00Z", Finished_at: "2026-01-01T09:00:01.5Z", Duration_ms: 1500},
+		{Task: "b", Status: status_failed, Started_at: "2026-01-01T09:00:02Z", Finished_at: "2026-01-01T09:00:02Z", Error: "exit status 1"},
+		{Task: "c", Status: status_skipped, Started_at: "2026-01-01T09:00:02Z", Finished_at: "2026-01-01T09:00:02Z", Blocked_by: "b"},
+	}
+	for i := range want {
+		want[i].Run = recorder.run
+	}
+	if !reflect.DeepEqual(records, want) {
+		t.Errorf("got %+v\nwant %+v", records, want)
+	}
+}
+
+func Test_load_history_truncated_last_line(t *testing.T) {
+	path := use_test_history(t)
+	complete := `{"run":"1","task":"a","status":"succeeded","finished_at":"2026-01-01T09:00:00Z"}` + "\n"
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, []byte(complete+`{"run":"2","task":"b","sta`), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	records, err := load_history(path)
+	if err != nil || len(records) != 1 || records[0].Task != "a" {
+		t.Fatalf("got %+v, %v, want the complete record only", records, err)
+	}
+
+	// The next record replaces the cut-off line instead of being glued onto it
+	new_history_recorder().record(run_event{Type: event_task_finished, Task: "c", Status: status_succeeded})
+	records, err = load_history(path)
+	if err != nil || len(records) != 2 || records[1].Task != "c" {
+		t.Errorf("after appending: got %+v, %v, want records a and c", records, err)
+	}
+
+	// A broken line that was completed is corruption, not a crash
+	if err := os.WriteFile(path, []byte("{broken\n"+complete), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := load_history(path); err == nil || !strings.Contains(err.Error(), "line 1") {
+		t.Errorf("broken first line: got %v, want an error for line 1", err)
+	}
+}
+
+func Test_compute_task_stats(t *testing.T) {
+	var records []history_record
+	for i, duration := range []float64{10, 20, 30, 40, 500} {
+		status := status_succeeded
+		if i == 1 {
+			status = status_failed
+		}
+		records = append(records, history_record{Task: "build", Status: status, Duration_ms: duration, Finished_at: fmt.Sprintf("2026-01-01T09:00:0%dZ", i)})
+	}
+	records = append(records,
+		history_record{Task: "build", Status: status_skipped, Finished_at: "2026-01-01T09:00:09Z"},
+		history_record{Task: "test", Status: status_cancelled, Finished_at: "2026-01-01T09:00:09Z"},
+	)
+
+	stats := compute_task_stats(records)
+	want := map[string]task_stats{
+		"build": {Task: "build", Runs: 5, Skipped: 1, Succeeded: 4, Success_rate: 0.8, Median_ms: 30, P95_ms: 500,
+			Last_status: status_skipped, Last_run_at: "2026-01-01T09:00:09Z"},
+		"test": {Task: "test", Skipped: 1, Last_status: status_cancelled, Last_run_at: "2026-01-01T09:00:09Z"},
+	}
+	if !reflect.DeepEqual(stats, want) {
+		t.Errorf("got %+v\nwant %+v", stats, want)
+	}
+
+	path := use_test_history(t)
+	recorder := &history_recorder{run: "1", path: path}
+	for _, record := range records {
+		recorder.record(run_event{Type: event_task_finished, Task: record.Task, Status: record.Status,
+			Time: record.Finished_at, Duration_ms: record.Duration_ms})
+	}
+	output := capture_stdout(t, func() { run_stats([]string{"--history", path}) })
+	for _, line := range []string{
+		"  - build: 5 run(s), 80% succeeded, median 30ms, p95 500ms, 1 skipped, last skipped at 2026-01-01T09:00:09Z\n",
+		"  - test: 0 run(s), 0% succeeded, median 0s, p95 0s, 1 skipped, last cancelled at 2026-01-01T09:00:09Z\n",
+	} {
+		if !strings.Contains(output, line) {
+			t.Errorf("dag stats lacks %q:\n%s", line, output)
+		}
+	}
+}
+
+func Test_compute_task_stats_last_run(t *testing.T) {
+	tests := []struct {
+		name    string
+		records []history_record
+		want    string // Last_status
+	}{
+		{
+			name: "time zones",
+			records: []history_record{
+				{Task: "a", Status: status_succeeded, Finished_at: "2026-01-01T09:00:00Z"},
+				{Task: "a", Status: status_failed, Finished_at: "2026-01-01T10:00:00+02:00"}, // 08:00 UTC
+			},
+			want: status_succeeded,
+		},
+		{
+			name: "fractional seconds",
+			records: []history_record{
+				{Task: "a", Status: status_failed, Finished_at: "2026-01-01T09:00:00Z"},
+				{Task: "a", Status: status_succeeded, Finished_at: "2026-01-01T09:00:00.5Z"},
+			},
+			want: status_succeeded,
+		},
+		{
+			name: "tie goes to the later record",
+			records: []history_record{
+				{Task: "a", Status: status_failed, Finished_at: "2026-01-01T09:00:00Z"},
+				{Task: "a", Status: status_succeeded, Finished_at: "2026-01-01T09:00:00Z"},
+			},
+			want: status_succeeded,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			stat := compute_task_stats(test.records)["a"]
+			if stat.Last_status != test.want {
+				t.Errorf("got %s at %s, want %s", stat.Last_status, stat.Last_run_at, test.want)
+			}
+		})
+	}
+}
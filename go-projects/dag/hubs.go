@@ -0,0 +1,205 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// hub_stats describes how much of the DAG depends on a single node
+type hub_stats struct {
+	name              string
+	count             int              // transitive dependents
+	direct_count      int              // direct dependents
+	max_depth         int              // deepest level in dependents_by_lvl
+	betweenness       float64          // betweenness centrality
+	dependents_by_lvl map[int][]string // distance -> dependents
+	all_sorted        []string         // lexically sorted flat list of dependents
+}
+
+// hub_rankers compares two hubs by one criterion: negative if a ranks first, positive if b does, 0 on a tie
+var hub_rankers = map[string]func(a, b hub_stats) int{
+	"count":        func(a, b hub_stats) int { return b.count - a.count },
+	"max-depth":    func(a, b hub_stats) int { return b.max_depth - a.max_depth },
+	"direct-count": func(a, b hub_stats) int { return b.direct_count - a.direct_count },
+	"betweenness": func(a, b hub_stats) int {
+		switch {
+		case a.betweenness > b.betweenness:
+			return -1
+		case a.betweenness < b.betweenness:
+			return 1
+		}
+		return 0
+	},
+	"name": func(a, b hub_stats) int { return strings.Compare(a.name, b.name) },
+	"lexicographic": func(a, b hub_stats) int {
+		if compare_lexicographic(a.all_sorted, b.all_sorted) {
+			return -1
+		}
+		if compare_lexicographic(b.all_sorted, a.all_sorted) {
+			return 1
+		}
+		return 0
+	},
+}
+
+// run_hubs prints the nodes other tasks depend on, ranked by the --rank-by criteria in order
+func run_hubs(args []string) {
+	flags := flag.NewFlagSet("hubs", flag.ExitOnError)
+	add_logging_flags(flags)
+	rank_by := flags.String("rank-by", "count,max-depth,lexicographic",
+		"comma-separated tie-breakers: count, max-depth, direct-count, betweenness, name, lexicographic")
+	details := flags.Bool("details", false, "list each node's dependents grouped by level")
+	distance := flags.String("distance", distance_longest,
+		"level of a dependent reachable over several paths: shortest, longest or all")
+	add_source_flags(flags)
+	flags.Parse(args)
+
+	switch *distance {
+	case distance_shortest, distance_longest, distance_all:
+	default:
+		fatal_usage("unknown_distance_mode", "distance", *distance)
+	}
+
+	var keys []string
+	for _, key := range strings.Split(*rank_by, ",") {
+		key = strings.TrimSpace(key)
+		if _, ok := hub_rankers[key]; !ok {
+			fatal_usage("unknown_rank_key", "key", key)
+		}
+		keys = append(keys, key)
+	}
+
+	// Step 1: Download and parse dag.yaml
+	dag, err := load_dag()
+	if err != nil {
+		fatal_error("dag_load_failed", err)
+	}
+	if err := check_dag(dag); err != nil {
+		fatal_error("dag_invalid", err)
+	}
+
+	// Step 2: Analyze and rank
+	stats := analyze_hubs(dag, *distance)
+	rank_hubs(stats, keys)
+
+	// Step 3: Output
+	fmt.Printf("📍 Nodes that are used as dependencies (recursively), ranked by %s:\n", strings.Join(keys, ", "))
+	show_betweenness := strings.Contains(","+strings.Join(keys, ",")+",", ",betweenness,")
+	for _, stat := range stats {
+		summary := fmt.Sprintf("%d dependents, %d direct, max depth %d", stat.count, stat.direct_count, stat.max_depth)
+		if show_betweenness {
+			summary += fmt.Sprintf(", betweenness %.2f", stat.betweenness)
+		}
+
+		if !*details {
+			fmt.Printf("  - %s (%s)\n", stat.name, summary)
+			continue
+		}
+
+		fmt.Printf("\n🔧 %s (%s)\n", stat.name, summary)
+		var levels []int
+		for lvl := range stat.dependents_by_lvl {
+			levels = append(levels, lvl)
+		}
+		sort.Ints(levels)
+		for _, lvl := range levels {
+			fmt.Printf("\n  Level %d:\n", lvl)
+			for _, dep := range stat.dependents_by_lvl[lvl] {
+				fmt.Printf("    - %s\n", dep)
+			}
+		}
+	}
+}
+
+// analyze_hubs computes hub_stats for every node that has at least one dependent,
+// grouping dependents by level according to the distance mode
+func analyze_hubs(dag map[string][]string, mode string) []hub_stats {
+	reverse := build_reverse_graph(dag)
+	betweenness := compute_betweenness(dag)
+	levels := dependents_by_distance(dag, mode)
+
+	var entries []hub_stats
+	for node := range dag {
+		bylvl := levels[node]
+		if len(bylvl) == 0 {
+			continue
+		}
+		seen := make(map[string]bool)
+		max_depth := 0
+		for lvl, dependents := range bylvl {
+			for _, dep := range dependents {
+				seen[dep] = true
+			}
+			if lvl > max_depth {
+				max_depth = lvl
+			}
+		}
+		all := set_to_sorted_list(seen)
+
+		entries = append(entries, hub_stats{
+			name:              node,
+			count:             len(all),
+			direct_count:      len(reverse[node]),
+			max_depth:         max_depth,
+			betweenness:       betweenness[node],
+			dependents_by_lvl: bylvl,
+			all_sorted:        all,
+		})
+	}
+	return entries
+}
+
+// rank_hubs sorts stats by each key in turn, falling back to the node name
+func rank_hubs(stats []hub_stats, keys []string) {
+	sort.Slice(stats, func(i, j int) bool {
+		for _, key := range keys {
+			if c := hub_rankers[key](stats[i], stats[j]); c != 0 {
+				return c < 0
+			}
+		}
+		return stats[i].name < stats[j].name
+	})
+}
+
+// compute_betweenness returns the betweenness centrality of every node using Brandes' algorithm,
+// counting shortest dependency paths (task -> dependency) that pass through each node
+func compute_betweenness(dag map[string][]string) map[string]float64 {
+	centrality := make(map[string]float64)
+	for source := range dag {
+		var stack []string
+		predecessors := make(map[string][]string)
+		path_count := map[string]float64{source: 1}
+		distance := map[string]int{source: 0}
+
+		queue := []string{source}
+		for len(queue) > 0 {
+			node := queue[0]
+			queue = queue[1:]
+			stack = append(stack, node)
+			for _, dep := range dag[node] {
+				if _, visited := distance[dep]; !visited {
+					distance[dep] = distance[node] + 1
+					queue = append(queue, dep)
+				}
+				if distance[dep] == distance[node]+1 {
+					path_count[dep] += path_count[node]
+					predecessors[dep] = append(predecessors[dep], node)
+				}
+			}
+		}
+
+		dependency := make(map[string]float64)
+		for i := len(stack) - 1; i >= 0; i-- {
+			node := stack[i]
+			for _, pred := range predecessors[node] {
+				dependency[pred] += path_count[pred] / path_count[node] * (1 + dependency[node])
+			}
+			if node != source {
+				centrality[node] += dependency[node]
+			}
+		}
+	}
+	return centrality
+}
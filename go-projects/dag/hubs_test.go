@@ -0,0 +1,52 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func Test_compute_betweenness(t *testing.T) {
+	tests := []struct {
+		name string
+		dag  map[string][]string
+		want map[string]float64
+	}{
+		{
+			// a -> b -> c -> d: b is on a->c and a->d, c on a->d and b->d
+			name: "path",
+			dag:  map[string][]string{"a": {"b"}, "b": {"c"}, "c": {"d"}, "d": {}},
+			want: map[string]float64{"b": 2, "c": 2},
+		},
+		{
+			// s1 and s2 depend on hub, which depends on l1 and l2: hub is on all four s->l paths
+			name: "star",
+			dag:  map[string][]string{"s1": {"hub"}, "s2": {"hub"}, "hub": {"l1", "l2"}, "l1": {}, "l2": {}},
+			want: map[string]float64{"hub": 4},
+		},
+		{
+			// The direct edge top -> base is the only shortest path, so left and right carry none
+			name: "diamond",
+			dag:  diamond_dag,
+			want: map[string]float64{},
+		},
+		{
+			// Two shortest paths from top to bottom share the credit
+			name: "split",
+			dag:  map[string][]string{"top": {"x", "y"}, "x": {"bottom"}, "y": {"bottom"}, "bottom": {}},
+			want: map[string]float64{"x": 0.5, "y": 0.5},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got := compute_betweenness(test.dag)
+			for node, value := range got {
+				if value == 0 {
+					delete(got, node)
+				}
+			}
+			if !reflect.DeepEqual(got, test.want) {
+				t.Errorf("got %v, want %v", got, test.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,353 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"encoding/xml"
+	"flag"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// importers maps each --from to the function that turns a file into a task -> dependencies map.
+// path is the file being imported ("-" for standard input), used to resolve relative references.
+var importers = map[string]func(content []byte, path string) (map[string][]string, error){
+	"make":  import_make,
+	"gomod": import_gomod,
+	"choco": import_choco,
+	"npm":   import_npm,
+}
+
+// run_import converts another tool's dependency description into a dag.yaml
+func run_import(args []string) {
+	flags := flag.NewFlagSet("import", flag.ExitOnError)
+	add_logging_flags(flags)
+	from := flags.String("from", "", "input format: "+strings.Join(import_formats(), ", "))
+	output := flags.String("output", "", "file to write (default: standard output)")
+	flags.Parse(args)
+
+	importer, ok := importers[*from]
+	if !ok {
+		fatal_usage("unknown_import_format", "from", *from, "formats", strings.Join(import_formats(), ", "))
+	}
+	if flags.NArg() != 1 {
+		fatal_usage("usage", "usage", "dag import --from FORMAT [--output dag.yaml] FILE (- for standard input)")
+	}
+	path := flags.Arg(0)
+
+	// Step 1: Read the input
+	var content []byte
+	var err error
+	if path == "-" {
+		content, err = io.ReadAll(os.Stdin)
+	} else {
+		content, err = os.ReadFile(path)
+	}
+	if err != nil {
+		fatal("file_read_failed", "error", err)
+	}
+
+	// Step 2: Convert, making sure every dependency is a task of its own
+	dag, err := importer(content, path)
+	if err != nil {
+		fatal("import_failed", "from", *from, "error", err)
+	}
+	close_graph(dag)
+	if err := check_dag(dag); err != nil {
+		slog.Warn("imported_graph_invalid", "error", err, "hint", "levels and orders need an acyclic graph")
+	}
+
+	// Step 3: Write
+	rendered := render_dag_yaml(dag, fmt.Sprintf("# Imported by dag import --from %s from %s\n", *from, path))
+	if *output == "" {
+		fmt.Print(rendered)
+		return
+	}
+	if err := os.WriteFile(*output, []byte(rendered), 0o644); err != nil {
+		fatal("file_write_failed", "error", err)
+	}
+	fmt.Printf("📥 wrote %s (%d tasks from %s)\n", *output, len(dag), *from)
+}
+
+// import_formats returns the supported --from values in alphabetical order
+func import_formats() []string {
+	formats := make([]string, 0, len(importers))
+	for format := range importers {
+		formats = append(formats, format)
+	}
+	sort.Strings(formats)
+	return formats
+}
+
+// close_graph adds every dependency that is not a task yet as a task without dependencies
+func close_graph(dag map[string][]string) {
+	for _, deps := range dag {
+		for _, dep := range deps {
+			if _, ok := dag[dep]; !ok {
+				dag[dep] = []string{}
+			}
+		}
+	}
+}
+
+// render_dag_yaml writes dag in the layout of the repository's dag.yaml: one block per level, sorted by name,
+// with dependencies as a flow list of quoted names
+func render_dag_yaml(dag map[string][]string, header string) string {
+	var out strings.Builder
+	out.WriteString(header)
+	out.WriteString("dag:\n")
+
+	levels := make(map[string]int)
+	if check_dag(dag) == nil {
+		levels = compute_levels(dag)
+	}
+	tasks := sorted_tasks(dag)
+	sort.SliceStable(tasks, func(i, j int) bool {
+		return levels[tasks[i]] < levels[tasks[j]]
+	})
+	for i, task := range tasks {
+		if i > 0 && levels[task] != levels[tasks[i-1]] {
+			out.WriteString("\n")
+		}
+		deps := make([]string, 0, len(dag[task]))
+		for _, dep := range dag[task] {
+			deps = append(deps, strconv.Quote(dep))
+		}
+		sort.Strings(deps)
+		fmt.Fprintf(&out, "  %s: [%s]\n", format_task_name(task, false), strings.Join(deps, ", "))
+	}
+	return out.String()
+}
+
+// import_make reads the rules of a Makefile. Targets of a Makefile written by dag export --format make get
+// the task name from the comment line directly above them; other Makefiles keep their target names.
+func import_make(content []byte, path string) (map[string][]string, error) {
+	rules, err := parse_make_prerequisites(string(content))
+	if err != nil {
+		return nil, err
+	}
+
+	// Comments name the targets and "all" is the aggregate target only in a Makefile dag export wrote.
+	// Elsewhere a comment such as "# Build the binary" documents the target and "all" may be a real one.
+	names := make(map[string]string)
+	if strings.HasPrefix(string(content), "# Generated by dag export") {
+		names = exported_make_names(string(content))
+		delete(rules, "all")
+	}
+
+	dag := make(map[string][]string)
+	rename := func(target string) string {
+		if name, ok := names[target]; ok {
+			return name
+		}
+		return target
+	}
+	for target, prerequisites := range rules {
+		deps := []string{}
+		for _, prerequisite := range prerequisites {
+			deps = append(deps, rename(prerequisite))
+		}
+		dag[rename(target)] = unique_strings(deps)
+	}
+	return dag, nil
+}
+
+// exported_make_names maps the targets of an exported Makefile to task names: a "# name" comment followed by
+// .PHONY and rule lines of a single target names that target
+func exported_make_names(content string) map[string]string {
+	names := make(map[string]string)
+	comment := ""
+	for _, line := range strings.Split(content, "\n") {
+		line = strings.TrimRight(line, "\r")
+		switch {
+		case strings.HasPrefix(line, "# "):
+			comment = strings.TrimPrefix(line, "# ")
+		case strings.HasPrefix(line, ".PHONY:"):
+			// keep the comment for the rule that follows
+		default:
+			if colon := strings.Index(line, ":"); comment != "" && colon > 0 && !strings.HasPrefix(line, "\t") {
+				if targets := strings.Fields(line[:colon]); len(targets) == 1 {
+					names[targets[0]] = comment
+				}
+			}
+			comment = ""
+		}
+	}
+	return names
+}
+
+// import_gomod reads the output of go mod graph: one "module@version dependency@version" edge per line
+func import_gomod(content []byte, path string) (map[string][]string, error) {
+	dag := make(map[string][]string)
+	scanner := bufio.NewScanner(strings.NewReader(string(content)))
+	line_number := 0
+	for scanner.Scan() {
+		line_number++
+		fields := strings.Fields(scanner.Text())
+		if len(fields) == 0 {
+			continue
+		}
+		if len(fields) != 2 {
+			return nil, fmt.Errorf("line %d: expected two modules, found %d fields", line_number, len(fields))
+		}
+		dag[fields[0]] = append(dag[fields[0]], fields[1])
+	}
+	for module, deps := range dag {
+		dag[module] = unique_strings(deps)
+	}
+	return dag, scanner.Err()
+}
+
+// import_choco reads a Chocolatey packages.config, where every package is installed after Chocolatey itself
+// like the install tasks of dag.yaml, or a .nuspec, where the package depends on its declared dependencies
+func import_choco(content []byte, path string) (map[string][]string, error) {
+	var document struct {
+		XMLName  xml.Name
+		Packages []struct {
+			Id string `xml:"id,attr"`
+		} `xml:"package"`
+		Metadata struct {
+			Id           string `xml:"id"`
+			Dependencies struct {
+				Dependency []struct {
+					Id string `xml:"id,attr"`
+				} `xml:"dependency"`
+				Groups []struct {
+					Dependency []struct {
+						Id string `xml:"id,attr"`
+					} `xml:"dependency"`
+				} `xml:"group"`
+			} `xml:"dependencies"`
+		} `xml:"metadata"`
+	}
+	if err := xml.Unmarshal(content, &document); err != nil {
+		return nil, err
+	}
+
+	dag := make(map[string][]string)
+	switch document.XMLName.Local {
+	case "packages":
+		dag["install choco"] = []string{}
+		for _, pkg := range document.Packages {
+			if pkg.Id != "" && pkg.Id != "chocolatey" {
+				dag["install "+pkg.Id] = []string{"install choco"}
+			}
+		}
+	case "package":
+		metadata := document.Metadata
+		if metadata.Id == "" {
+			return nil, fmt.Errorf("nuspec has no metadata id")
+		}
+		var deps []string
+		for _, dep := range metadata.Dependencies.Dependency {
+			deps = append(deps, "install "+dep.Id)
+		}
+		for _, group := range metadata.Dependencies.Groups {
+			for _, dep := range group.Dependency {
+				deps = append(deps, "install "+dep.Id)
+			}
+		}
+		dag["install "+metadata.Id] = unique_strings(deps)
+	default:
+		return nil, fmt.Errorf("expected <packages> (packages.config) or <package> (.nuspec), found <%s>", document.XMLName.Local)
+	}
+	return dag, nil
+}
+
+// npm_package is the part of package.json that import_npm reads
+type npm_package struct {
+	Name                  string            `json:"name"`
+	Workspaces            json.RawMessage   `json:"workspaces"`
+	Dependencies          map[string]string `json:"dependencies"`
+	Dev_dependencies      map[string]string `json:"devDependencies"`
+	Peer_dependencies     map[string]string `json:"peerDependencies"`
+	Optional_dependencies map[string]string `json:"optionalDependencies"`
+}
+
+// import_npm reads the root package.json of an npm workspace and the package.json of every workspace.
+// Tasks are the workspace packages; dependencies between them, of any kind, become edges.
+func import_npm(content []byte, path string) (map[string][]string, error) {
+	if path == "-" {
+		return nil, fmt.Errorf("npm workspaces are read relative to package.json, so standard input is not supported")
+	}
+	var root npm_package
+	if err := json.Unmarshal(content, &root); err != nil {
+		return nil, err
+	}
+
+	// "workspaces" is either a list of globs or {"packages": [...]}
+	var patterns []string
+	if len(root.Workspaces) == 0 {
+		return nil, fmt.Errorf("%s declares no workspaces", path)
+	}
+	if err := json.Unmarshal(root.Workspaces, &patterns); err != nil {
+		var object struct {
+			Packages []string `json:"packages"`
+		}
+		if err := json.Unmarshal(root.Workspaces, &object); err != nil {
+			return nil, fmt.Errorf("workspaces: %w", err)
+		}
+		patterns = object.Packages
+	}
+	if len(patterns) == 0 {
+		return nil, fmt.Errorf("%s declares no workspaces", path)
+	}
+
+	packages := make(map[string]npm_package)
+	base := filepath.Dir(path)
+	for _, pattern := range patterns {
+		dirs, err := filepath.Glob(filepath.Join(base, filepath.FromSlash(pattern)))
+		if err != nil {
+			return nil, err
+		}
+		for _, dir := range dirs {
+			raw, err := os.ReadFile(filepath.Join(dir, "package.json"))
+			if os.IsNotExist(err) {
+				continue
+			}
+			if err != nil {
+				return nil, err
+			}
+			var pkg npm_package
+			if err := json.Unmarshal(raw, &pkg); err != nil {
+				return nil, fmt.Errorf("%s: %w", filepath.Join(dir, "package.json"), err)
+			}
+			if pkg.Name == "" {
+				pkg.Name = filepath.Base(dir)
+			}
+			packages[pkg.Name] = pkg
+		}
+	}
+
+	dag := make(map[string][]string)
+	for name, pkg := range packages {
+		deps := []string{}
+		for _, group := range []map[string]string{pkg.Dependencies, pkg.Dev_dependencies, pkg.Peer_dependencies, pkg.Optional_dependencies} {
+			for dep := range group {
+				if _, ok := packages[dep]; ok {
+					deps = append(deps, dep)
+				}
+			}
+		}
+		dag[name] = unique_strings(deps)
+	}
+	return dag, nil
+}
+
+// unique_strings returns values sorted and without duplicates
+func unique_strings(values []string) []string {
+	sort.Strings(values)
+	unique := []string{}
+	for i, value := range values {
+		if i == 0 || value != values[i-1] {
+			unique = append(unique, value)
+		}
+	}
+	return unique
+}
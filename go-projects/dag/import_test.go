@@ -0,0 +1,190 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func Test_import_make(t *testing.T) {
+	handwritten := "# Build the binary\nbuild: gen\n\tgo build ./...\n\n# Generate code\ngen:\n\tgo generate ./...\n\nall: build\n"
+	got, err := import_make([]byte(handwritten), "Makefile")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[string][]string{"build": {"gen"}, "gen": {}, "all": {"build"}}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("hand-written Makefile: got %v, want %v", got, want)
+	}
+
+	// An exported Makefile gives back the task names it was generated from
+	parsed := dag_file{Dag: map[string][]string{"install vs code": {}, "build app": {"install vs code"}}}
+	exported, err := export_make(new_export_input(parsed, "dag.yaml"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err = import_make([]byte(exported), "Makefile")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if diff := diff_graphs(parsed.Dag, got); diff != "" {
+		t.Errorf("exported Makefile: %s", diff)
+	}
+}
+
+func Test_import_gomod(t *testing.T) {
+	tests := []struct {
+		name     string
+		input    string
+		want     map[string][]string
+		want_err string
+	}{
+		{
+			name:  "edges",
+			input: "app golang.org/x/sys@v0.1.0\napp gopkg.in/yaml.v3@v3.0.1\n\napp golang.org/x/sys@v0.1.0\ngopkg.in/yaml.v3@v3.0.1 gopkg.in/check.v1@v0.0.0\n",
+			want: map[string][]string{
+				"app":                     {"golang.org/x/sys@v0.1.0", "gopkg.in/yaml.v3@v3.0.1"},
+				"gopkg.in/yaml.v3@v3.0.1": {"gopkg.in/check.v1@v0.0.0"},
+			},
+		},
+		{name: "empty", input: "", want: map[string][]string{}},
+		{name: "three fields", input: "app a@v1\napp b@v1 c@v1\n", want_err: "line 2: expected two modules, found 3 fields"},
+		{name: "one field", input: "app\n", want_err: "line 1: expected two modules, found 1 fields"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got, err := import_gomod([]byte(test.input), "-")
+			check_import(t, got, err, test.want, test.want_err)
+		})
+	}
+}
+
+func Test_import_choco(t *testing.T) {
+	tests := []struct {
+		name     string
+		input    string
+		want     map[string][]string
+		want_err string
+	}{
+		{
+			name:  "packages.config",
+			input: `<?xml version="1.0" encoding="utf-8"?><packages><package id="git" version="2.44.0" /><package id="chocolatey" /><package id="vscode" /></packages>`,
+			want: map[string][]string{
+				"install choco":  {},
+				"install git":    {"install choco"},
+				"install vscode": {"install choco"},
+			},
+		},
+		{
+			name: "nuspec",
+			input: `<package><metadata><id>tools</id><dependencies>
+				<dependency id="git" />
+				<group targetFramework="net48"><dependency id="dotnet" /><dependency id="git" /></group>
+			</dependencies></metadata></package>`,
+			want: map[string][]string{"install tools": {"install dotnet", "install git"}},
+		},
+		{name: "nuspec without dependencies", input: `<package><metadata><id>tools</id></metadata></package>`, want: map[string][]string{"install tools": {}}},
+		{name: "nuspec without id", input: `<package><metadata></metadata></package>`, want_err: "nuspec has no metadata id"},
+		{name: "other root", input: `<project></project>`, want_err: "found <project>"},
+		{name: "malformed", input: `<packages><package id="git"></packages>`, want_err: "XML syntax error"},
+		{name: "empty", input: "", want_err: "EOF"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got, err := import_choco([]byte(test.input), "packages.config")
+			check_import(t, got, err, test.want, test.want_err)
+		})
+	}
+}
+
+func Test_import_npm(t *testing.T) {
+	// use_test_workspace writes files, relative to a new directory, and returns the path of its package.json
+	use_test_workspace := func(t *testing.T, files map[string]string) string {
+		t.Helper()
+		dir := t.TempDir()
+		for name, content := range files {
+			path := filepath.Join(dir, filepath.FromSlash(name))
+			if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+				t.Fatal(err)
+			}
+			if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+				t.Fatal(err)
+			}
+		}
+		return filepath.Join(dir, "package.json")
+	}
+	packages := map[string]string{
+		"packages/app/package.json":    `{"name": "@acme/app", "dependencies": {"@acme/ui": "*", "react": "^18"}, "devDependencies": {"tools": "*"}}`,
+		"packages/ui/package.json":     `{"name": "@acme/ui", "peerDependencies": {"react": "^18"}, "optionalDependencies": {"@acme/config": "*"}}`,
+		"packages/config/package.json": `{"name": "@acme/config", "devDependencies": {"typescript": "^5"}}`,
+		"packages/tools/package.json":  `{"dependencies": {"@acme/config": "*"}}`,
+		"packages/docs/README.md":      "not a package",
+	}
+	workspace := func(root string) map[string]string {
+		files := map[string]string{"package.json": root}
+		for name, content := range packages {
+			files[name] = content
+		}
+		return files
+	}
+	// tools has no name, so it is named after its directory; docs has no package.json, so it is no task
+	want := map[string][]string{
+		"@acme/app":    {"@acme/ui", "tools"},
+		"@acme/ui":     {"@acme/config"},
+		"@acme/config": {},
+		"tools":        {"@acme/config"},
+	}
+
+	tests := []struct {
+		name     string
+		files    map[string]string
+		want     map[string][]string
+		want_err string
+	}{
+		{name: "list", files: workspace(`{"workspaces": ["packages/*"]}`), want: want},
+		{name: "object", files: workspace(`{"workspaces": {"packages": ["packages/*"]}}`), want: want},
+		{name: "no workspaces", files: map[string]string{"package.json": `{"name": "single"}`}, want_err: "declares no workspaces"},
+		{name: "empty workspaces", files: map[string]string{"package.json": `{"workspaces": {"packages": []}}`}, want_err: "declares no workspaces"},
+		{name: "workspaces of the wrong type", files: map[string]string{"package.json": `{"workspaces": "packages/*"}`}, want_err: "workspaces:"},
+		{name: "malformed root", files: map[string]string{"package.json": `{"workspaces": [`}, want_err: "unexpected end of JSON input"},
+		{
+			name:     "malformed workspace",
+			files:    map[string]string{"package.json": `{"workspaces": ["packages/*"]}`, "packages/bad/package.json": `{"name": 1}`},
+			want_err: filepath.Join("packages", "bad", "package.json") + ": json: cannot unmarshal number",
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			path := use_test_workspace(t, test.files)
+			content, err := os.ReadFile(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			got, err := import_npm(content, path)
+			check_import(t, got, err, test.want, test.want_err)
+		})
+	}
+
+	if _, err := import_npm([]byte(`{"workspaces": ["packages/*"]}`), "-"); err == nil || !strings.Contains(err.Error(), "standard input is not supported") {
+		t.Errorf("standard input: error %v, want standard input is not supported", err)
+	}
+}
+
+// check_import compares the result of an importer with want, or its error with want_err when that is set
+func check_import(t *testing.T, got map[string][]string, err error, want map[string][]string, want_err string) {
+	t.Helper()
+	if want_err != "" {
+		if err == nil || !strings.Contains(err.Error(), want_err) {
+			t.Errorf("error %v, want one containing %q", err, want_err)
+		}
+		return
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+}
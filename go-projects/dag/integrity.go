@@ -0,0 +1,198 @@
+package main
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// pinned_sha256 is the expected hex SHA-256 digest of dag.yaml, if pinned
+var pinned_sha256 string
+
+// public_key is the base64 ed25519 public key (or a file containing it) that must have signed dag.yaml
+var public_key string
+
+// signature_location overrides where the detached signature is read from (default: the source plus ".sig")
+var signature_location string
+
+// add_integrity_flags registers the flags that verify dag.yaml before anything is planned or run
+func add_integrity_flags(flags *flag.FlagSet) {
+	flags.StringVar(&pinned_sha256, "sha256", "", "refuse dag.yaml unless its SHA-256 digest matches this hex value")
+	flags.StringVar(&public_key, "public-key", os.Getenv("DAG_PUBLIC_KEY"),
+		"base64 ed25519 public key (or a file containing it) that must have signed dag.yaml; defaults to $DAG_PUBLIC_KEY")
+	flags.StringVar(&signature_location, "signature", "", "URL or path of the detached signature (default: source + \".sig\")")
+}
+
+// verify_integrity checks content against the pinned digest and signature; mismatches wrap ErrIntegrity
+func verify_integrity(content []byte, location string) error {
+	if pinned_sha256 != "" {
+		sum := sha256.Sum256(content)
+		actual := hex.EncodeToString(sum[:])
+		if !strings.EqualFold(actual, strings.TrimSpace(pinned_sha256)) {
+			return fmt.Errorf("%w: %s has sha256 %s, expected %s", ErrIntegrity, location, actual, pinned_sha256)
+		}
+	}
+
+	if public_key == "" {
+		return nil
+	}
+	key, err := read_base64_value(public_key)
+	if err != nil {
+		return fmt.Errorf("%w: invalid public key: %v", ErrIntegrity, err)
+	}
+	if len(key) != ed25519.PublicKeySize {
+		return fmt.Errorf("%w: invalid public key: %d bytes, expected %d", ErrIntegrity, len(key), ed25519.PublicKeySize)
+	}
+
+	sig_location := signature_location
+	if sig_location == "" {
+		sig_location = location + ".sig"
+	}
+	raw_signature, err := read_signature(sig_location, location)
+	if err != nil {
+		return fmt.Errorf("%w: read signature: %v", ErrIntegrity, err)
+	}
+	signature, err := base64.StdEncoding.DecodeString(strings.TrimSpace(string(raw_signature)))
+	if err != nil {
+		return fmt.Errorf("%w: decode signature: %v", ErrIntegrity, err)
+	}
+	if !ed25519.Verify(ed25519.PublicKey(key), content, signature) {
+		return fmt.Errorf("%w: %s is not signed by the configured public key", ErrIntegrity, location)
+	}
+	return nil
+}
+
+// read_signature reads the signature of the dag.yaml at location. A downloaded signature is cached next to
+// the cached dag.yaml, so that --offline verifies the cached copy against the signature fetched with it.
+func read_signature(sig_location string, location string) ([]byte, error) {
+	if !strings.HasPrefix(sig_location, "http://") && !strings.HasPrefix(sig_location, "https://") {
+		return os.ReadFile(sig_location)
+	}
+	data_path, _, err := cache_paths(location)
+	if err != nil {
+		if offline {
+			return nil, err
+		}
+		return read_location(sig_location)
+	}
+	cache_path := data_path + ".sig"
+	if offline {
+		return os.ReadFile(cache_path)
+	}
+
+	content, err := read_location(sig_location)
+	if err != nil {
+		if cached, cached_err := os.ReadFile(cache_path); cached_err == nil && !require_fresh_source {
+			slog.Warn("signature_download_failed", "error", err, "fallback", "cached signature")
+			return cached, nil
+		}
+		return nil, err
+	}
+	if err := os.MkdirAll(filepath.Dir(cache_path), 0o755); err != nil {
+		slog.Warn("cache_write_failed", "error", err)
+	} else if err := write_file_atomic(cache_path, content); err != nil {
+		slog.Warn("cache_write_failed", "error", err)
+	}
+	return content, nil
+}
+
+// read_location reads a local path or downloads a URL
+func read_location(location string) ([]byte, error) {
+	if !strings.HasPrefix(location, "http://") && !strings.HasPrefix(location, "https://") {
+		return os.ReadFile(location)
+	}
+	client := &http.Client{Timeout: 30 * time.Second}
+	response, err := client.Get(location)
+	if err != nil {
+		return nil, &ErrDownload{Url: location, Err: err}
+	}
+	defer response.Body.Close()
+	if response.StatusCode != http.StatusOK {
+		return nil, &ErrDownload{Url: location, Status_code: response.StatusCode, Err: errors.New(response.Status)}
+	}
+	return io.ReadAll(response.Body)
+}
+
+// read_base64_value decodes value, or the contents of the file it names
+func read_base64_value(value string) ([]byte, error) {
+	if content, err := os.ReadFile(value); err == nil {
+		value = string(content)
+	}
+	return base64.StdEncoding.DecodeString(strings.TrimSpace(value))
+}
+
+// run_keygen writes a new ed25519 key pair to PREFIX.key and PREFIX.pub
+func run_keygen(args []string) {
+	if len(args) != 1 {
+		fatal_usage("usage", "usage", "dag keygen PREFIX")
+	}
+	if err := write_key_pair(args[0]); err != nil {
+		fatal_error("keygen_failed", err)
+	}
+	fmt.Printf("🔑 wrote %s.key and %s.pub\n", args[0], args[0])
+}
+
+// write_key_pair generates an ed25519 key pair and writes it base64-encoded to prefix.key and prefix.pub
+func write_key_pair(prefix string) error {
+	public, private, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		return err
+	}
+	err = os.WriteFile(prefix+".key", []byte(base64.StdEncoding.EncodeToString(private)+"\n"), 0o600)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(prefix+".pub", []byte(base64.StdEncoding.EncodeToString(public)+"\n"), 0o644)
+}
+
+// run_sign writes FILE.sig, the detached ed25519 signature of FILE
+func run_sign(args []string) {
+	flags := flag.NewFlagSet("sign", flag.ExitOnError)
+	add_logging_flags(flags)
+	key_path := flags.String("key", "", "private key written by dag keygen")
+	flags.Parse(args)
+
+	if *key_path == "" || flags.NArg() != 1 {
+		fatal_usage("usage", "usage", "dag sign --key PREFIX.key FILE")
+	}
+	sum, err := sign_file(*key_path, flags.Arg(0))
+	if err != nil {
+		fatal_error("sign_failed", err)
+	}
+	fmt.Printf("✍️ wrote %s.sig (sha256 %s)\n", flags.Arg(0), hex.EncodeToString(sum[:]))
+}
+
+// sign_file signs path with the base64 private key in key_path, writes path + ".sig" and returns the SHA-256
+// digest of the signed content
+func sign_file(key_path string, path string) ([sha256.Size]byte, error) {
+	key, err := read_base64_value(key_path)
+	if err != nil {
+		return [sha256.Size]byte{}, fmt.Errorf("invalid private key %s: %w", key_path, err)
+	}
+	if len(key) != ed25519.PrivateKeySize {
+		return [sha256.Size]byte{}, fmt.Errorf("invalid private key %s: got %d bytes, want %d", key_path, len(key), ed25519.PrivateKeySize)
+	}
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return [sha256.Size]byte{}, err
+	}
+
+	signature := ed25519.Sign(ed25519.PrivateKey(key), content)
+	err = os.WriteFile(path+".sig", []byte(base64.StdEncoding.EncodeToString(signature)+"\n"), 0o644)
+	if err != nil {
+		return [sha256.Size]byte{}, err
+	}
+	return sha256.Sum256(content), nil
+}
@@ -0,0 +1,147 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"flag"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// use_test_integrity resets the integrity flags for one test
+func use_test_integrity(t *testing.T) {
+	t.Helper()
+	saved_sha256, saved_key, saved_signature := pinned_sha256, public_key, signature_location
+	t.Cleanup(func() {
+		pinned_sha256, public_key, signature_location = saved_sha256, saved_key, saved_signature
+	})
+	pinned_sha256, public_key, signature_location = "", "", ""
+}
+
+// signed_test_file writes dag.yaml, a key pair and its signature into a temporary directory with dag keygen and
+// dag sign, returning the paths of dag.yaml and the public key
+func signed_test_file(t *testing.T) (string, string) {
+	t.Helper()
+	dir := t.TempDir()
+	path := filepath.Join(dir, "dag.yaml")
+	if err := os.WriteFile(path, []byte(test_dag_yaml), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	prefix := filepath.Join(dir, "test")
+	run_keygen([]string{prefix})
+	run_sign([]string{"--key", prefix + ".key", path})
+	return path, prefix + ".pub"
+}
+
+func Test_verify_integrity_signature(t *testing.T) {
+	use_test_integrity(t)
+	path, public := signed_test_file(t)
+	public_key = public
+
+	if err := verify_integrity([]byte(test_dag_yaml), path); err != nil {
+		t.Errorf("signed file: %v", err)
+	}
+
+	tampered := []byte(test_dag_yaml + "  c: [b]\n")
+	if err := verify_integrity(tampered, path); !errors.Is(err, ErrIntegrity) {
+		t.Errorf("tampered file: got %v, want ErrIntegrity", err)
+	}
+
+	// A signature by another key is refused
+	_, other := signed_test_file(t)
+	public_key = other
+	if err := verify_integrity([]byte(test_dag_yaml), path); !errors.Is(err, ErrIntegrity) {
+		t.Errorf("other key: got %v, want ErrIntegrity", err)
+	}
+}
+
+func Test_sign_then_verify_with_flags(t *testing.T) {
+	use_test_integrity(t)
+	path, public := signed_test_file(t)
+
+	// The signature is read from --signature, not from the default path + ".sig"
+	moved := filepath.Join(t.TempDir(), "detached.sig")
+	if err := os.Rename(path+".sig", moved); err != nil {
+		t.Fatal(err)
+	}
+	flags := flag.NewFlagSet("run", flag.ContinueOnError)
+	add_integrity_flags(flags)
+	if err := flags.Parse([]string{"--public-key", public, "--signature", moved}); err != nil {
+		t.Fatal(err)
+	}
+
+	content, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := verify_integrity(content, path); err != nil {
+		t.Errorf("signed file: %v", err)
+	}
+
+	if err := os.WriteFile(path, append(content, "  c: [b]\n"...), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	tampered, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := verify_integrity(tampered, path); !errors.Is(err, ErrIntegrity) || exit_code(err) != exit_integrity {
+		t.Errorf("tampered file: got %v, want ErrIntegrity", err)
+	}
+}
+
+func Test_sign_file_rejects_wrong_key_length(t *testing.T) {
+	path, public := signed_test_file(t)
+	// A public key is a valid base64 ed25519 key, but not a private one
+	_, err := sign_file(public, path)
+	if err == nil || !strings.Contains(err.Error(), "got 32 bytes, want 64") {
+		t.Errorf("got %v, want the length mismatch", err)
+	}
+}
+
+func Test_verify_integrity_sha256(t *testing.T) {
+	use_test_integrity(t)
+	pinned_sha256 = "3f2b6a4c"
+	if err := verify_integrity([]byte(test_dag_yaml), "dag.yaml"); !errors.Is(err, ErrIntegrity) {
+		t.Errorf("wrong digest: got %v, want ErrIntegrity", err)
+	}
+
+	sum := sha256.Sum256([]byte(test_dag_yaml))
+	pinned_sha256 = strings.ToUpper(hex.EncodeToString(sum[:]))
+	if err := verify_integrity([]byte(test_dag_yaml), "dag.yaml"); err != nil {
+		t.Errorf("pinned digest: %v", err)
+	}
+}
+
+func Test_verify_integrity_offline_uses_cached_signature(t *testing.T) {
+	use_test_integrity(t)
+	path, public := signed_test_file(t)
+	signature, err := os.ReadFile(path + ".sig")
+	if err != nil {
+		t.Fatal(err)
+	}
+	requests := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		w.Write(signature)
+	}))
+	defer server.Close()
+	use_test_source(t, server.URL+"/dag.yaml")
+	public_key = public
+
+	if err := verify_integrity([]byte(test_dag_yaml), server.URL+"/dag.yaml"); err != nil {
+		t.Fatalf("online: %v", err)
+	}
+	offline = true
+	if err := verify_integrity([]byte(test_dag_yaml), server.URL+"/dag.yaml"); err != nil {
+		t.Errorf("offline: %v", err)
+	}
+	if requests != 1 {
+		t.Errorf("server saw %d requests, want 1: --offline must read the cached signature", requests)
+	}
+}
@@ -0,0 +1,128 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"slices"
+	"sort"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+const lock_version = 1
+
+// lock_file pins the resolved graph and the digests of the sources it was resolved from
+type lock_file struct {
+	Version      int                     `yaml:"version"`
+	Generated_at string                  `yaml:"generated_at"`
+	Sources      []source_digest         `yaml:"sources"`
+	Dag          map[string][]string     `yaml:"dag"`
+	Tags         map[string][]string     `yaml:"tags,omitempty"`
+	Run          map[string]task_command `yaml:"run,omitempty"`
+	Policy       map[string]string       `yaml:"policy,omitempty"`
+}
+
+// run_lock writes dag.lock for the current source
+func run_lock(args []string) {
+	flags := flag.NewFlagSet("lock", flag.ExitOnError)
+	add_logging_flags(flags)
+	output := flags.String("output", "dag.lock", "path of the lock file to write")
+	add_source_flags(flags)
+	flags.Parse(args)
+
+	// Step 1: Load and resolve the DAG
+	parsed, digest, err := load_dag_source()
+	if err != nil {
+		fatal_error("dag_load_failed", err)
+	}
+	if err := check_dag(parsed.Dag); err != nil {
+		fatal_error("dag_invalid", err)
+	}
+
+	// Step 2: Write the lock file
+	lock := lock_file{
+		Version:      lock_version,
+		Generated_at: time.Now().Format(time.RFC3339),
+		Sources:      []source_digest{digest},
+		Dag:          parsed.Dag,
+		Tags:         parsed.Tags,
+		Run:          parsed.Run,
+		Policy:       parsed.Policy,
+	}
+	if err := write_lock(*output, lock); err != nil {
+		fatal_error("lock_write_failed", err)
+	}
+
+	fmt.Printf("🔒 wrote %s (%d tasks, sha256 %s)\n", *output, len(parsed.Dag), digest.Sha256)
+}
+
+// write_lock writes lock to path with a header telling readers not to edit it
+func write_lock(path string, lock lock_file) error {
+	content, err := yaml.Marshal(lock)
+	if err != nil {
+		return err
+	}
+	content = append([]byte("# Generated by dag lock. Do not edit; re-run dag lock instead.\n"), content...)
+	return os.WriteFile(path, content, 0o644)
+}
+
+// read_lock_file parses a lock file written by dag lock; a missing or unreadable lock file wraps ErrIntegrity,
+// because --locked cannot vouch for the source without it
+func read_lock_file(path string) (lock_file, error) {
+	var lock lock_file
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return lock, fmt.Errorf("%w: read lock file: %v", ErrIntegrity, err)
+	}
+	if err := yaml.Unmarshal(content, &lock); err != nil {
+		return lock, fmt.Errorf("%w: parse lock file %s: %v", ErrIntegrity, path, err)
+	}
+	if lock.Version != lock_version {
+		return lock, fmt.Errorf("%w: lock file %s has version %d, expected %d", ErrIntegrity, path, lock.Version, lock_version)
+	}
+	return lock, nil
+}
+
+// verify_lock returns an error wrapping ErrIntegrity if the live source no longer matches the lock file
+func verify_lock(lock lock_file, parsed dag_file, digest source_digest) error {
+	if len(lock.Sources) != 1 {
+		return fmt.Errorf("%w: lock file must list exactly one source, found %d", ErrIntegrity, len(lock.Sources))
+	}
+	locked := lock.Sources[0]
+	if locked.Location != digest.Location {
+		return fmt.Errorf("%w: source changed from %s to %s", ErrIntegrity, locked.Location, digest.Location)
+	}
+	if locked.Sha256 != digest.Sha256 {
+		return fmt.Errorf("%w: content of %s changed from sha256 %s to %s; run dag lock to accept the change",
+			ErrIntegrity, digest.Location, locked.Sha256, digest.Sha256)
+	}
+	if diff := diff_graphs(lock.Dag, parsed.Dag); diff != "" {
+		return fmt.Errorf("%w: resolved graph differs from the lock file: %s", ErrIntegrity, diff)
+	}
+	return nil
+}
+
+// diff_graphs describes the first difference between two graphs, or returns "" if they are equal
+func diff_graphs(locked map[string][]string, live map[string][]string) string {
+	for _, task := range sorted_tasks(locked) {
+		deps, ok := live[task]
+		if !ok {
+			return fmt.Sprintf("task %q was removed", task)
+		}
+		a := append([]string(nil), locked[task]...)
+		b := append([]string(nil), deps...)
+		sort.Strings(a)
+		sort.Strings(b)
+		if !slices.Equal(a, b) {
+			return fmt.Sprintf("dependencies of %q changed from %q to %q", task, a, b)
+		}
+	}
+	for _, task := range sorted_tasks(live) {
+		if _, ok := locked[task]; !ok {
+			return fmt.Sprintf("task %q was added", task)
+		}
+	}
+	return ""
+}
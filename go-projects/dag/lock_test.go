@@ -0,0 +1,93 @@
+package main
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// test_lock returns a lock file for dag and the source digest it was resolved from
+func test_lock(dag map[string][]string) (lock_file, source_digest) {
+	digest := source_digest{Location: "dag.yaml", Sha256: "3f2b6a4c"}
+	return lock_file{
+		Version:      lock_version,
+		Generated_at: "2026-01-02T03:04:05Z",
+		Sources:      []source_digest{digest},
+		Dag:          dag,
+		Policy:       map[string]string{"a": "allow-failure"},
+	}, digest
+}
+
+func Test_lock_round_trip(t *testing.T) {
+	lock, digest := test_lock(map[string][]string{"a": {}, "b": {"a"}})
+	path := filepath.Join(t.TempDir(), "dag.lock")
+	if err := write_lock(path, lock); err != nil {
+		t.Fatal(err)
+	}
+	read, err := read_lock_file(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(read, lock) {
+		t.Errorf("read %+v, wrote %+v", read, lock)
+	}
+	if err := verify_lock(read, dag_file{Dag: map[string][]string{"b": {"a"}, "a": {}}}, digest); err != nil {
+		t.Errorf("unchanged source: %v", err)
+	}
+}
+
+func Test_verify_lock_mismatch(t *testing.T) {
+	lock, digest := test_lock(map[string][]string{"a": {}, "b": {"a"}})
+	tests := []struct {
+		name   string
+		dag    map[string][]string
+		digest source_digest
+		want   string
+	}{
+		{"location", lock.Dag, source_digest{Location: "other.yaml", Sha256: digest.Sha256}, "source changed"},
+		{"content", lock.Dag, source_digest{Location: digest.Location, Sha256: "0000"}, "run dag lock"},
+		{"removed", map[string][]string{"b": {}}, digest, `task "a" was removed`},
+		{"added", map[string][]string{"a": {}, "b": {"a"}, "c": {}}, digest, `task "c" was added`},
+		{"dependencies", map[string][]string{"a": {}, "b": {}}, digest, `dependencies of "b" changed`},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			err := verify_lock(lock, dag_file{Dag: test.dag}, test.digest)
+			if !errors.Is(err, ErrIntegrity) || exit_code(err) != exit_integrity {
+				t.Fatalf("got %v, want ErrIntegrity", err)
+			}
+			if !strings.Contains(err.Error(), test.want) {
+				t.Errorf("got %v, want it to mention %q", err, test.want)
+			}
+		})
+	}
+}
+
+func Test_diff_graphs_compares_names_exactly(t *testing.T) {
+	// fmt.Sprint prints both dependency lists as [a b]
+	locked := map[string][]string{"a b": {}, "a": {}, "b": {}, "c": {"a b"}}
+	live := map[string][]string{"a b": {}, "a": {}, "b": {}, "c": {"a", "b"}}
+	if diff := diff_graphs(locked, live); diff == "" {
+		t.Error("got no difference between [\"a b\"] and [\"a\" \"b\"]")
+	}
+}
+
+func Test_read_lock_file_errors(t *testing.T) {
+	dir := t.TempDir()
+	wrong_version := filepath.Join(dir, "version.lock")
+	if err := os.WriteFile(wrong_version, []byte("version: 99\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	invalid := filepath.Join(dir, "invalid.lock")
+	if err := os.WriteFile(invalid, []byte("dag: [\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	for _, path := range []string{filepath.Join(dir, "missing.lock"), wrong_version, invalid} {
+		if _, err := read_lock_file(path); !errors.Is(err, ErrIntegrity) {
+			t.Errorf("%s: got %v, want ErrIntegrity", filepath.Base(path), err)
+		}
+	}
+}
@@ -0,0 +1,56 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log/slog"
+	"os"
+)
+
+// log_level is the minimum level logged; flags may change it after the handler is installed
+var log_level = new(slog.LevelVar)
+
+// configure_logging installs the default logger on stderr from $DAG_LOG_LEVEL and $DAG_LOG_FORMAT
+func configure_logging() {
+	if level := os.Getenv("DAG_LOG_LEVEL"); level != "" {
+		if err := log_level.UnmarshalText([]byte(level)); err != nil {
+			fmt.Fprintf(os.Stderr, "invalid DAG_LOG_LEVEL %q, using info\n", level)
+		}
+	}
+	format := os.Getenv("DAG_LOG_FORMAT")
+	if format == "" {
+		format = "text"
+	}
+	if err := set_log_format(format); err != nil {
+		fmt.Fprintf(os.Stderr, "%v, using text\n", err)
+		set_log_format("text")
+	}
+}
+
+// add_logging_flags registers --log-level and --log-format, which take effect as soon as they are parsed
+func add_logging_flags(flags *flag.FlagSet) {
+	flags.Func("log-level", "minimum log level: debug, info, warn or error (default $DAG_LOG_LEVEL or info)", func(value string) error {
+		return log_level.UnmarshalText([]byte(value))
+	})
+	flags.Func("log-format", "log format: text or json (default $DAG_LOG_FORMAT or text)", set_log_format)
+}
+
+// set_log_format replaces the default logger with a text or JSON handler writing to stderr
+func set_log_format(format string) error {
+	options := &slog.HandlerOptions{Level: log_level}
+	switch format {
+	case "text":
+		slog.SetDefault(slog.New(slog.NewTextHandler(os.Stderr, options)))
+	case "json":
+		slog.SetDefault(slog.New(slog.NewJSONHandler(os.Stderr, options)))
+	default:
+		return fmt.Errorf("unknown log format %q", format)
+	}
+	return nil
+}
+
+// fatal logs msg with its attributes at error level and exits with status 1
+func fatal(msg string, args ...any) {
+	slog.Error(msg, args...)
+	os.Exit(1)
+}
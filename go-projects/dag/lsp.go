@@ -0,0 +1,417 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/textproto"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// JSON-RPC error codes used by the language server
+const (
+	rpc_method_not_found = -32601
+	rpc_invalid_params   = -32602
+	rpc_request_failed   = -32803
+)
+
+// LSP completion item kind for a reference to a task
+const completion_kind_reference = 18
+
+type lsp_position struct {
+	Line      int `json:"line"`
+	Character int `json:"character"`
+}
+
+type lsp_range struct {
+	Start lsp_position `json:"start"`
+	End   lsp_position `json:"end"`
+}
+
+type lsp_location struct {
+	Uri   string    `json:"uri"`
+	Range lsp_range `json:"range"`
+}
+
+type lsp_text_edit struct {
+	Range    lsp_range `json:"range"`
+	New_text string    `json:"newText"`
+}
+
+type lsp_diagnostic struct {
+	Range    lsp_range `json:"range"`
+	Severity int       `json:"severity"`
+	Source   string    `json:"source"`
+	Message  string    `json:"message"`
+}
+
+type lsp_completion_item struct {
+	Label       string        `json:"label"`
+	Kind        int           `json:"kind"`
+	Detail      string        `json:"detail,omitempty"`
+	Filter_text string        `json:"filterText"`
+	Text_edit   lsp_text_edit `json:"textEdit"`
+}
+
+// rpc_message is a JSON-RPC request, notification or response
+type rpc_message struct {
+	Jsonrpc string           `json:"jsonrpc"`
+	Id      *json.RawMessage `json:"id,omitempty"`
+	Method  string           `json:"method,omitempty"`
+	Params  json.RawMessage  `json:"params,omitempty"`
+	Result  any              `json:"result,omitempty"`
+	Error   *rpc_error       `json:"error,omitempty"`
+}
+
+type rpc_error struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+}
+
+// text_document_position is the params of completion, definition, references and rename
+type text_document_position struct {
+	Text_document struct {
+		Uri string `json:"uri"`
+	} `json:"textDocument"`
+	Position lsp_position `json:"position"`
+	Context  struct {
+		Include_declaration bool `json:"includeDeclaration"`
+	} `json:"context"`
+	New_name string `json:"newName"`
+}
+
+// lsp_server holds the open documents of one client connection
+type lsp_server struct {
+	output io.Writer
+	mutex  sync.Mutex // serialises writes to output
+
+	documents map[string]*lsp_document // uri -> latest text
+	parsed    map[string]*lsp_document // uri -> latest text that parsed, used for completion while editing
+	shutdown  bool
+}
+
+// run_lsp serves the Language Server Protocol on stdin and stdout
+func run_lsp(args []string) {
+	flags := flag.NewFlagSet("lsp", flag.ExitOnError)
+	add_logging_flags(flags)
+	flags.Bool("stdio", true, "communicate over stdin and stdout (the only transport)")
+	flags.Parse(args)
+
+	server := &lsp_server{
+		output:    os.Stdout,
+		documents: make(map[string]*lsp_document),
+		parsed:    make(map[string]*lsp_document),
+	}
+	if err := server.serve(os.Stdin); err != nil {
+		fatal("lsp_failed", "error", err)
+	}
+	if !server.shutdown {
+		os.Exit(1)
+	}
+}
+
+// serve reads messages until exit or end of input
+func (s *lsp_server) serve(input io.Reader) error {
+	reader := textproto.NewReader(bufio.NewReader(input))
+	for {
+		header, err := reader.ReadMIMEHeader()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		length, err := strconv.Atoi(header.Get("Content-Length"))
+		if err != nil {
+			return fmt.Errorf("invalid Content-Length: %w", err)
+		}
+		body := make([]byte, length)
+		if _, err := io.ReadFull(reader.R, body); err != nil {
+			return err
+		}
+
+		var message rpc_message
+		if err := json.Unmarshal(body, &message); err != nil {
+			slog.Warn("lsp_invalid_message", "error", err)
+			continue
+		}
+		if message.Method == "exit" {
+			return nil
+		}
+		s.handle(message)
+	}
+}
+
+// handle dispatches one request or notification
+func (s *lsp_server) handle(message rpc_message) {
+	slog.Debug("lsp_message", "method", message.Method)
+	var params text_document_position
+	json.Unmarshal(message.Params, &params)
+	doc := s.documents[params.Text_document.Uri]
+
+	var result any
+	var failure *rpc_error
+	switch message.Method {
+	case "initialize":
+		result = map[string]any{
+			"capabilities": map[string]any{
+				"textDocumentSync":   1, // full text on every change
+				"completionProvider": map[string]any{"triggerCharacters": []string{"[", ",", "\"", " "}},
+				"hoverProvider":      true,
+				"definitionProvider": true,
+				"referencesProvider": true,
+				"renameProvider":     true,
+			},
+			"serverInfo": map[string]any{"name": "dag"},
+		}
+	case "shutdown":
+		s.shutdown = true
+	case "textDocument/didOpen", "textDocument/didChange":
+		var change struct {
+			Text_document struct {
+				Uri  string `json:"uri"`
+				Text string `json:"text"`
+			} `json:"textDocument"`
+			Content_changes []struct {
+				Text string `json:"text"`
+			} `json:"contentChanges"`
+		}
+		json.Unmarshal(message.Params, &change)
+		text := change.Text_document.Text
+		if n := len(change.Content_changes); n > 0 {
+			text = change.Content_changes[n-1].Text
+		}
+		s.open(change.Text_document.Uri, text)
+	case "textDocument/didClose":
+		delete(s.documents, params.Text_document.Uri)
+		delete(s.parsed, params.Text_document.Uri)
+		s.notify("textDocument/publishDiagnostics", map[string]any{"uri": params.Text_document.Uri, "diagnostics": []lsp_diagnostic{}})
+	case "textDocument/completion":
+		result = s.completion(doc, params)
+	case "textDocument/hover":
+		result = s.hover(doc, params)
+	case "textDocument/definition":
+		result = s.definition(doc, params)
+	case "textDocument/references":
+		result = s.references(doc, params)
+	case "textDocument/rename":
+		result, failure = s.rename(doc, params)
+	default:
+		if message.Id != nil && !strings.HasPrefix(message.Method, "$/") {
+			failure = &rpc_error{Code: rpc_method_not_found, Message: "unsupported method " + message.Method}
+		}
+	}
+
+	if message.Id == nil {
+		return
+	}
+	if doc == nil && failure == nil && strings.HasPrefix(message.Method, "textDocument/") {
+		failure = &rpc_error{Code: rpc_invalid_params, Message: "document is not open"}
+	}
+	s.write(rpc_message{Jsonrpc: "2.0", Id: message.Id, Result: non_nil_result(result, failure), Error: failure})
+}
+
+// non_nil_result returns result, or an explicit JSON null for successful requests without one
+func non_nil_result(result any, failure *rpc_error) any {
+	if result == nil && failure == nil {
+		return json.RawMessage("null")
+	}
+	return result
+}
+
+// open indexes the new text of a document and publishes its diagnostics
+func (s *lsp_server) open(uri string, text string) {
+	doc := new_lsp_document(uri, text)
+	s.documents[uri] = doc
+	if doc.dag != nil {
+		s.parsed[uri] = doc
+	}
+	diagnostics := doc.diagnostics
+	if diagnostics == nil {
+		diagnostics = []lsp_diagnostic{}
+	}
+	s.notify("textDocument/publishDiagnostics", map[string]any{"uri": uri, "diagnostics": diagnostics})
+}
+
+// completion offers every task that can be added to the dependency list under the cursor without creating a cycle
+// and is not in the list yet
+func (s *lsp_server) completion(doc *lsp_document, params text_document_position) []lsp_completion_item {
+	items := []lsp_completion_item{}
+	if doc == nil {
+		return items
+	}
+	task, prefix, start, listed, ok := doc.completion_context(params.Position)
+	if !ok {
+		return items
+	}
+	known := s.parsed[params.Text_document.Uri]
+	if known == nil {
+		return items
+	}
+
+	excluded := known.dependents(task)
+	excluded[task] = true
+	for _, name := range listed {
+		excluded[name] = true
+	}
+	edit_range := lsp_range{
+		Start: lsp_position{Line: params.Position.Line, Character: doc.utf16_column(params.Position.Line, start)},
+		End:   params.Position,
+	}
+	quoted := strings.HasPrefix(prefix, "\"")
+	for _, name := range known.sorted_definitions() {
+		if excluded[name] {
+			continue
+		}
+		text := format_task_name(name, true)
+		filter := name
+		if quoted {
+			filter = text
+		}
+		items = append(items, lsp_completion_item{
+			Label:       name,
+			Kind:        completion_kind_reference,
+			Detail:      fmt.Sprintf("%d dependencies", len(known.dag[name])),
+			Filter_text: filter,
+			Text_edit:   lsp_text_edit{Range: edit_range, New_text: text},
+		})
+	}
+	return items
+}
+
+// hover describes the task under the cursor: its level, dependencies and dependents
+func (s *lsp_server) hover(doc *lsp_document, params text_document_position) any {
+	if doc == nil {
+		return nil
+	}
+	task := doc.task_at(params.Position)
+	deps, defined := doc.dag[task]
+	if task == "" || !defined {
+		return nil
+	}
+	names := func(tasks []string) string {
+		if len(tasks) == 0 {
+			return "nothing"
+		}
+		quoted := make([]string, len(tasks))
+		for i, name := range tasks {
+			quoted[i] = "`" + name + "`"
+		}
+		sort.Strings(quoted)
+		return strings.Join(quoted, ", ")
+	}
+	title := "**" + task + "**"
+	if check_dag(doc.dag) == nil {
+		title += fmt.Sprintf(" · level %d", compute_levels(doc.dag)[task])
+	}
+	value := fmt.Sprintf("%s\n\ndepends on %s\n\nneeded by %s", title, names(deps), names(build_reverse_graph(doc.dag)[task]))
+	return map[string]any{"contents": map[string]string{"kind": "markdown", "value": value}}
+}
+
+// definition jumps from a task name to its key in the dag section
+func (s *lsp_server) definition(doc *lsp_document, params text_document_position) []lsp_location {
+	locations := []lsp_location{}
+	if doc == nil {
+		return locations
+	}
+	for _, span := range doc.definitions[doc.task_at(params.Position)] {
+		locations = append(locations, lsp_location{Uri: doc.uri, Range: doc.lsp_range(span, false)})
+	}
+	return locations
+}
+
+// references lists where the task under the cursor is depended on (its direct dependents in the reverse graph),
+// tagged and given a command, plus its definition when the client asks for it
+func (s *lsp_server) references(doc *lsp_document, params text_document_position) []lsp_location {
+	locations := []lsp_location{}
+	if doc == nil {
+		return locations
+	}
+	task := doc.task_at(params.Position)
+	if task == "" {
+		return locations
+	}
+	if params.Context.Include_declaration {
+		for _, span := range doc.definitions[task] {
+			locations = append(locations, lsp_location{Uri: doc.uri, Range: doc.lsp_range(span, false)})
+		}
+	}
+
+	dependents := make(map[string]bool)
+	for _, dependent := range build_reverse_graph(doc.dag)[task] {
+		dependents[dependent] = true
+	}
+	for _, ref := range doc.references {
+		if ref.task != task {
+			continue
+		}
+		if ref.kind == "dependency" && !dependents[ref.from] {
+			continue
+		}
+		locations = append(locations, lsp_location{Uri: doc.uri, Range: doc.lsp_range(ref.span, false)})
+	}
+	sort.SliceStable(locations, func(i, j int) bool {
+		return locations[i].Range.Start.Line < locations[j].Range.Start.Line
+	})
+	return locations
+}
+
+// rename renames the task under the cursor at its definition and every reference
+func (s *lsp_server) rename(doc *lsp_document, params text_document_position) (any, *rpc_error) {
+	if doc == nil {
+		return nil, nil
+	}
+	task := doc.task_at(params.Position)
+	if task == "" {
+		return nil, &rpc_error{Code: rpc_request_failed, Message: "no task at the cursor"}
+	}
+	new_name := strings.TrimSpace(params.New_name)
+	if new_name == "" {
+		return nil, &rpc_error{Code: rpc_request_failed, Message: "the new name is empty"}
+	}
+	if _, exists := doc.definitions[new_name]; exists && new_name != task {
+		return nil, &rpc_error{Code: rpc_request_failed, Message: fmt.Sprintf("task %q already exists", new_name)}
+	}
+
+	edits := []lsp_text_edit{}
+	edit := func(span lsp_span) {
+		edits = append(edits, lsp_text_edit{Range: doc.lsp_range(span, true), New_text: format_task_name(new_name, span.quoted)})
+	}
+	for _, span := range doc.definitions[task] {
+		edit(span)
+	}
+	for _, ref := range doc.references {
+		if ref.task == task {
+			edit(ref.span)
+		}
+	}
+	return map[string]any{"changes": map[string][]lsp_text_edit{doc.uri: edits}}, nil
+}
+
+// notify sends a notification to the client
+func (s *lsp_server) notify(method string, params any) {
+	raw, err := json.Marshal(params)
+	if err != nil {
+		return
+	}
+	s.write(rpc_message{Jsonrpc: "2.0", Method: method, Params: raw})
+}
+
+// write frames and sends one message
+func (s *lsp_server) write(message rpc_message) {
+	body, err := json.Marshal(message)
+	if err != nil {
+		slog.Warn("lsp_encode_failed", "error", err)
+		return
+	}
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	fmt.Fprintf(s.output, "Content-Length: %d\r\n\r\n%s", len(body), body)
+}
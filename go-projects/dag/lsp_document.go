@@ -0,0 +1,421 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode/utf16"
+	"unicode/utf8"
+
+	"gopkg.in/yaml.v3"
+)
+
+// LSP diagnostic severities
+const (
+	severity_error   = 1
+	severity_warning = 2
+)
+
+// lsp_span locates a task name in a document: a 0-based line and a [start, end) range of rune columns.
+// For quoted names the range excludes the quotes.
+type lsp_span struct {
+	line   int
+	start  int
+	end    int
+	quoted bool
+}
+
+// lsp_reference is a use of a task name outside its definition
+type lsp_reference struct {
+	task string // the task referred to
+	from string // the task whose dependency list, tags or command holds the reference
+	kind string // "dependency", "tags", "run" or "policy"
+	span lsp_span
+}
+
+// lsp_document is an open dag.yaml with the positions of every task definition and reference
+type lsp_document struct {
+	uri         string
+	lines       []string
+	definitions map[string][]lsp_span // task -> key spans in the dag section; more than one means a duplicate
+	references  []lsp_reference
+	dag         map[string][]string // nil when the text does not parse
+	diagnostics []lsp_diagnostic
+}
+
+// new_lsp_document indexes text and computes its diagnostics
+func new_lsp_document(uri string, text string) *lsp_document {
+	doc := &lsp_document{
+		uri:         uri,
+		lines:       strings.Split(text, "\n"),
+		definitions: make(map[string][]lsp_span),
+	}
+
+	var root yaml.Node
+	if err := yaml.Unmarshal([]byte(text), &root); err != nil {
+		doc.add_parse_error(new_parse_error(uri, err, nil))
+		return doc
+	}
+	for _, violation := range validate_dag_node(&root, uri) {
+		var parse_error *ErrParse
+		if errors.As(violation, &parse_error) {
+			doc.add_parse_error(parse_error)
+		}
+	}
+	if root.Kind != yaml.DocumentNode || len(root.Content) == 0 || root.Content[0].Kind != yaml.MappingNode {
+		return doc
+	}
+
+	doc.dag = make(map[string][]string)
+	top := root.Content[0]
+	for i := 0; i+1 < len(top.Content); i += 2 {
+		section, value := top.Content[i].Value, top.Content[i+1]
+		if value.Kind != yaml.MappingNode {
+			continue
+		}
+		for j := 0; j+1 < len(value.Content); j += 2 {
+			key, entry := value.Content[j], value.Content[j+1]
+			switch section {
+			case "dag":
+				doc.definitions[key.Value] = append(doc.definitions[key.Value], doc.node_span(key))
+				deps := []string{}
+				if entry.Kind == yaml.SequenceNode {
+					for _, item := range entry.Content {
+						if item.Kind != yaml.ScalarNode || item.ShortTag() == "!!null" {
+							continue
+						}
+						deps = append(deps, item.Value)
+						doc.references = append(doc.references, lsp_reference{
+							task: item.Value, from: key.Value, kind: "dependency", span: doc.node_span(item),
+						})
+					}
+				}
+				doc.dag[key.Value] = deps
+			case "tags", "run", "policy":
+				doc.references = append(doc.references, lsp_reference{
+					task: key.Value, from: key.Value, kind: section, span: doc.node_span(key),
+				})
+			}
+		}
+	}
+	doc.check_references()
+	return doc
+}
+
+// node_span returns the span of a scalar node's value, starting at the node's line and column. A quoted scalar
+// ends at its closing quote: escapes such as \" make the name as written longer than its value.
+func (doc *lsp_document) node_span(node *yaml.Node) lsp_span {
+	span := lsp_span{line: node.Line - 1, start: node.Column - 1}
+	switch {
+	case node.Style&yaml.DoubleQuotedStyle != 0:
+		span.start++
+		span.quoted = true
+		span.end = doc.closing_quote(span.line, span.start, '"')
+	case node.Style&yaml.SingleQuotedStyle != 0:
+		span.start++
+		span.quoted = true
+		span.end = doc.closing_quote(span.line, span.start, '\'')
+	default:
+		span.end = span.start + utf8.RuneCountInString(node.Value)
+	}
+	return span
+}
+
+// closing_quote returns the rune column of the quote that closes a scalar whose text starts at column of line,
+// or the end of the line for a scalar that continues on the next one. Double-quoted scalars escape with a
+// backslash, single-quoted ones by doubling the quote.
+func (doc *lsp_document) closing_quote(line int, column int, quote rune) int {
+	if line < 0 || line >= len(doc.lines) {
+		return column
+	}
+	runes := []rune(strings.TrimRight(doc.lines[line], "\r"))
+	for i := column; i < len(runes); i++ {
+		switch {
+		case quote == '"' && runes[i] == '\\':
+			i++
+		case runes[i] == quote && quote == '\'' && i+1 < len(runes) && runes[i+1] == '\'':
+			i++
+		case runes[i] == quote:
+			return i
+		}
+	}
+	return len(runes)
+}
+
+// add_parse_error reports a syntax error or schema violation, highlighting from its column to the end of the line
+func (doc *lsp_document) add_parse_error(parse_error *ErrParse) {
+	line := max(parse_error.Line-1, 0)
+	start := max(parse_error.Column-1, 0)
+	end := start
+	if line < len(doc.lines) {
+		end = max(utf8.RuneCountInString(strings.TrimRight(doc.lines[line], " \r")), start)
+	}
+	message := parse_error.Message
+	if parse_error.Path != "" {
+		message = parse_error.Path + ": " + message
+	}
+	doc.add_diagnostic(lsp_span{line: line, start: start, end: end}, severity_error, message)
+}
+
+// check_references reports duplicate tasks, dangling references and the first dependency cycle
+func (doc *lsp_document) check_references() {
+	for task, spans := range doc.definitions {
+		for _, span := range spans[1:] {
+			doc.add_diagnostic(span, severity_error, fmt.Sprintf("task %q is defined more than once", task))
+		}
+	}
+
+	for _, ref := range doc.references {
+		if _, ok := doc.dag[ref.task]; ok {
+			continue
+		}
+		switch ref.kind {
+		case "dependency":
+			doc.add_diagnostic(ref.span, severity_error, (&ErrUnknownDependency{Task: ref.from, Dependency: ref.task}).Error())
+		default:
+			doc.add_diagnostic(ref.span, severity_warning, fmt.Sprintf("%s of unknown task %q", ref.kind, ref.task))
+		}
+	}
+
+	cycle := find_cycle(doc.dag)
+	if cycle == nil {
+		return
+	}
+	message := (&ErrCycle{Path: cycle}).Error()
+	for i := 0; i+1 < len(cycle); i++ {
+		for _, ref := range doc.references {
+			if ref.kind == "dependency" && ref.from == cycle[i] && ref.task == cycle[i+1] {
+				doc.add_diagnostic(ref.span, severity_error, message)
+			}
+		}
+	}
+}
+
+// add_diagnostic records a diagnostic for span
+func (doc *lsp_document) add_diagnostic(span lsp_span, severity int, message string) {
+	doc.diagnostics = append(doc.diagnostics, lsp_diagnostic{
+		Range:    doc.lsp_range(span, false),
+		Severity: severity,
+		Source:   "dag",
+		Message:  message,
+	})
+}
+
+// lsp_range converts a span to an LSP range, optionally widened to include the quotes
+func (doc *lsp_document) lsp_range(span lsp_span, with_quotes bool) lsp_range {
+	start, end := span.start, span.end
+	if with_quotes && span.quoted {
+		start--
+		end++
+	}
+	return lsp_range{
+		Start: lsp_position{Line: span.line, Character: doc.utf16_column(span.line, start)},
+		End:   lsp_position{Line: span.line, Character: doc.utf16_column(span.line, end)},
+	}
+}
+
+// utf16_column converts a rune column of line to the UTF-16 offset LSP clients count in
+func (doc *lsp_document) utf16_column(line int, column int) int {
+	if line < 0 || line >= len(doc.lines) {
+		return column
+	}
+	offset := 0
+	for i, r := range []rune(doc.lines[line]) {
+		if i >= column {
+			return offset
+		}
+		offset += utf16.RuneLen(r)
+	}
+	return offset + column - utf8.RuneCountInString(doc.lines[line])
+}
+
+// rune_column converts an LSP position to a rune column of its line
+func (doc *lsp_document) rune_column(position lsp_position) int {
+	if position.Line < 0 || position.Line >= len(doc.lines) {
+		return position.Character
+	}
+	offset := 0
+	for i, r := range []rune(doc.lines[position.Line]) {
+		if offset >= position.Character {
+			return i
+		}
+		offset += utf16.RuneLen(r)
+	}
+	return utf8.RuneCountInString(doc.lines[position.Line])
+}
+
+// task_at returns the task whose definition or reference covers position, or ""
+func (doc *lsp_document) task_at(position lsp_position) string {
+	column := doc.rune_column(position)
+	covers := func(span lsp_span) bool {
+		start, end := span.start, span.end
+		if span.quoted {
+			start--
+			end++
+		}
+		return span.line == position.Line && column >= start && column <= end
+	}
+	for task, spans := range doc.definitions {
+		for _, span := range spans {
+			if covers(span) {
+				return task
+			}
+		}
+	}
+	for _, ref := range doc.references {
+		if covers(ref.span) {
+			return ref.task
+		}
+	}
+	return ""
+}
+
+// dependents returns the tasks that depend on task, directly or transitively, using the reverse graph
+func (doc *lsp_document) dependents(task string) map[string]bool {
+	reverse := build_reverse_graph(doc.dag)
+	found := make(map[string]bool)
+	queue := []string{task}
+	for len(queue) > 0 {
+		current := queue[0]
+		queue = queue[1:]
+		for _, dependent := range reverse[current] {
+			if !found[dependent] {
+				found[dependent] = true
+				queue = append(queue, dependent)
+			}
+		}
+	}
+	return found
+}
+
+// completion_context reports whether position is inside a dependency list of the dag section.
+// It returns the task owning the list, the partially typed name, the rune column where that name starts and
+// the names already in the list besides the one being typed.
+// It works on the raw lines so that completion keeps working while the file does not parse.
+func (doc *lsp_document) completion_context(position lsp_position) (task string, prefix string, start int, listed []string, ok bool) {
+	if position.Line >= len(doc.lines) {
+		return "", "", 0, nil, false
+	}
+
+	// The nearest top-level key above the cursor must be dag:
+	section := ""
+	for i := position.Line; i >= 0; i-- {
+		line := strings.TrimRight(doc.lines[i], "\r")
+		if line == "" || line[0] == ' ' || line[0] == '\t' || line[0] == '#' {
+			continue
+		}
+		section = strings.TrimSpace(strings.TrimSuffix(strings.SplitN(line, ":", 2)[0], ":"))
+		break
+	}
+	if section != "dag" || position.Line == 0 {
+		return "", "", 0, nil, false
+	}
+
+	runes := []rune(strings.TrimRight(doc.lines[position.Line], "\r"))
+	column := min(doc.rune_column(position), len(runes))
+	before := string(runes[:column])
+
+	// Flow sequence: `  task: ["a", "b", |`
+	if open := strings.LastIndex(before, "["); open >= 0 && strings.LastIndex(before, "]") < open {
+		key_part := before[:open]
+		colon := strings.LastIndex(key_part, ":")
+		if colon < 0 {
+			return "", "", 0, nil, false
+		}
+		item_start := max(open, strings.LastIndex(before, ",")) + 1
+		for item_start < len(before) && before[item_start] == ' ' {
+			item_start++
+		}
+
+		// Items before the cursor end at its comma; items after it run up to the closing bracket
+		after := string(runes[column:])
+		if close := strings.Index(after, "]"); close >= 0 {
+			after = after[:close]
+		}
+		items := strings.Split(before[open+1:item_start], ",")
+		if comma := strings.Index(after, ","); comma >= 0 {
+			items = append(items, strings.Split(after[comma+1:], ",")...)
+		}
+		for _, item := range items {
+			if name := unquote_key(item); name != "" {
+				listed = append(listed, name)
+			}
+		}
+		return unquote_key(key_part[:colon]), before[item_start:], utf8.RuneCountInString(before[:item_start]), listed, true
+	}
+
+	// Block sequence: `    - a|` below `  task:`
+	trimmed := strings.TrimLeft(before, " ")
+	if !strings.HasPrefix(trimmed, "- ") && trimmed != "-" {
+		return "", "", 0, nil, false
+	}
+	indent := len(before) - len(trimmed)
+	item_start := indent + min(2, len(trimmed))
+	for i := position.Line - 1; i > 0; i-- {
+		line := strings.TrimRight(doc.lines[i], "\r")
+		line_trimmed := strings.TrimLeft(line, " ")
+		if line_trimmed == "" || strings.HasPrefix(line_trimmed, "#") || strings.HasPrefix(line_trimmed, "-") {
+			continue
+		}
+		if len(line)-len(line_trimmed) <= indent && strings.HasSuffix(line_trimmed, ":") {
+			return unquote_key(strings.TrimSuffix(line_trimmed, ":")), before[item_start:], utf8.RuneCountInString(before[:item_start]),
+				doc.block_items(i+1, position.Line), true
+		}
+		break
+	}
+	return "", "", 0, nil, false
+}
+
+// block_items returns the names of the block sequence whose items start at line first, skipping line cursor
+func (doc *lsp_document) block_items(first int, cursor int) []string {
+	var items []string
+	for i := first; i < len(doc.lines); i++ {
+		trimmed := strings.TrimSpace(doc.lines[i])
+		if trimmed == "" || strings.HasPrefix(trimmed, "#") {
+			continue
+		}
+		if !strings.HasPrefix(trimmed, "-") {
+			break
+		}
+		if name := unquote_key(strings.TrimPrefix(trimmed, "-")); i != cursor && name != "" {
+			items = append(items, name)
+		}
+	}
+	return items
+}
+
+// unquote_key returns the task name of a mapping key as written in the file
+func unquote_key(key string) string {
+	key = strings.TrimSpace(key)
+	if unquoted, err := strconv.Unquote(key); err == nil {
+		return unquoted
+	}
+	if len(key) >= 2 && key[0] == '\'' && key[len(key)-1] == '\'' {
+		return strings.ReplaceAll(key[1:len(key)-1], "''", "'")
+	}
+	return key
+}
+
+// plain_name_pattern matches task names that need no quotes anywhere in dag.yaml
+var plain_name_pattern = regexp.MustCompile(`^[A-Za-z0-9_][A-Za-z0-9_ .+-]*[A-Za-z0-9_.+-]$|^[A-Za-z0-9_]$`)
+
+// format_task_name renders name for the file, quoting it when it was quoted before or has to be
+func format_task_name(name string, quoted bool) string {
+	if quoted || !plain_name_pattern.MatchString(name) {
+		return strconv.Quote(name)
+	}
+	return name
+}
+
+// sorted_definitions returns the defined task names in alphabetical order
+func (doc *lsp_document) sorted_definitions() []string {
+	names := make([]string, 0, len(doc.definitions))
+	for name := range doc.definitions {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
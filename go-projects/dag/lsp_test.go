@@ -0,0 +1,333 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/textproto"
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+const test_lsp_uri = "file:///dag.yaml"
+
+// test_rpc_message is an rpc_message as the client decodes it
+type test_rpc_message struct {
+	Id     *int            `json:"id"`
+	Method string          `json:"method"`
+	Params json.RawMessage `json:"params"`
+	Result json.RawMessage `json:"result"`
+	Error  *rpc_error      `json:"error"`
+}
+
+// test_lsp is a language server writing to a buffer the tests read back
+type test_lsp struct {
+	server *lsp_server
+	output *bytes.Buffer
+	id     int
+}
+
+func new_test_lsp() *test_lsp {
+	output := &bytes.Buffer{}
+	return &test_lsp{server: &lsp_server{
+		output:    output,
+		documents: make(map[string]*lsp_document),
+		parsed:    make(map[string]*lsp_document),
+	}, output: output}
+}
+
+// send handles a request (notification if !request) and returns the messages the server wrote in response
+func (l *test_lsp) send(t *testing.T, method string, params any, request bool) []test_rpc_message {
+	t.Helper()
+	raw, err := json.Marshal(params)
+	if err != nil {
+		t.Fatal(err)
+	}
+	message := rpc_message{Jsonrpc: "2.0", Method: method, Params: raw}
+	if request {
+		l.id++
+		id := json.RawMessage(strconv.Itoa(l.id))
+		message.Id = &id
+	}
+	l.output.Reset()
+	l.server.handle(message)
+	return read_test_messages(t, l.output)
+}
+
+// call sends a request and decodes its result into result
+func (l *test_lsp) call(t *testing.T, method string, params any, result any) {
+	t.Helper()
+	messages := l.send(t, method, params, true)
+	if len(messages) != 1 || messages[0].Error != nil {
+		t.Fatalf("%s: got %+v, want one successful response", method, messages)
+	}
+	if err := json.Unmarshal(messages[0].Result, result); err != nil {
+		t.Fatalf("%s: %v in %s", method, err, messages[0].Result)
+	}
+}
+
+// open sends didOpen (or didChange when the document is open) and returns the published diagnostics
+func (l *test_lsp) open(t *testing.T, text string) []lsp_diagnostic {
+	t.Helper()
+	var messages []test_rpc_message
+	if _, ok := l.server.documents[test_lsp_uri]; ok {
+		messages = l.send(t, "textDocument/didChange", map[string]any{
+			"textDocument":   map[string]any{"uri": test_lsp_uri},
+			"contentChanges": []map[string]string{{"text": text}},
+		}, false)
+	} else {
+		messages = l.send(t, "textDocument/didOpen", map[string]any{
+			"textDocument": map[string]any{"uri": test_lsp_uri, "text": text},
+		}, false)
+	}
+	if len(messages) != 1 || messages[0].Method != "textDocument/publishDiagnostics" {
+		t.Fatalf("got %+v, want publishDiagnostics", messages)
+	}
+	var published struct {
+		Uri         string           `json:"uri"`
+		Diagnostics []lsp_diagnostic `json:"diagnostics"`
+	}
+	if err := json.Unmarshal(messages[0].Params, &published); err != nil {
+		t.Fatal(err)
+	}
+	return published.Diagnostics
+}
+
+// at returns the params of a request for position line:character of the test document
+func at(line int, character int) map[string]any {
+	return map[string]any{
+		"textDocument": map[string]any{"uri": test_lsp_uri},
+		"position":     lsp_position{Line: line, Character: character},
+	}
+}
+
+// read_test_messages decodes every framed message in output
+func read_test_messages(t *testing.T, output io.Reader) []test_rpc_message {
+	t.Helper()
+	reader := textproto.NewReader(bufio.NewReader(output))
+	var messages []test_rpc_message
+	for {
+		header, err := reader.ReadMIMEHeader()
+		if err == io.EOF {
+			return messages
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		length, err := strconv.Atoi(header.Get("Content-Length"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		body := make([]byte, length)
+		if _, err := io.ReadFull(reader.R, body); err != nil {
+			t.Fatal(err)
+		}
+		var message test_rpc_message
+		if err := json.Unmarshal(body, &message); err != nil {
+			t.Fatal(err)
+		}
+		messages = append(messages, message)
+	}
+}
+
+func Test_lsp_initialize_over_stdio(t *testing.T) {
+	var input strings.Builder
+	for i, body := range []string{
+		`{"jsonrpc":"2.0","id":1,"method":"initialize","params":{}}`,
+		`{"jsonrpc":"2.0","id":2,"method":"shutdown"}`,
+		`{"jsonrpc":"2.0","method":"exit"}`,
+		`{"jsonrpc":"2.0","id":3,"method":"never read"}`,
+	} {
+		fmt.Fprintf(&input, "Content-Length: %d\r\n\r\n%s", len(body), body)
+		if i == 0 {
+			input.WriteString("Content-Length: 5\r\n\r\n{bad}") // logged and skipped
+		}
+	}
+	lsp := new_test_lsp()
+	if err := lsp.server.serve(strings.NewReader(input.String())); err != nil {
+		t.Fatal(err)
+	}
+	if !lsp.server.shutdown {
+		t.Error("shutdown was not recorded")
+	}
+
+	messages := read_test_messages(t, lsp.output)
+	if len(messages) != 2 || *messages[0].Id != 1 || *messages[1].Id != 2 {
+		t.Fatalf("got %+v, want the responses to initialize and shutdown", messages)
+	}
+	var result struct {
+		Capabilities map[string]any `json:"capabilities"`
+	}
+	if err := json.Unmarshal(messages[0].Result, &result); err != nil {
+		t.Fatal(err)
+	}
+	for _, capability := range []string{"textDocumentSync", "completionProvider", "hoverProvider", "definitionProvider", "referencesProvider", "renameProvider"} {
+		if _, ok := result.Capabilities[capability]; !ok {
+			t.Errorf("initialize does not announce %s: %v", capability, result.Capabilities)
+		}
+	}
+	if string(messages[1].Result) != "null" {
+		t.Errorf("shutdown result %s, want null", messages[1].Result)
+	}
+}
+
+func Test_lsp_diagnostics(t *testing.T) {
+	span := func(line, start, end int) lsp_range {
+		return lsp_range{Start: lsp_position{Line: line, Character: start}, End: lsp_position{Line: line, Character: end}}
+	}
+	tests := []struct {
+		name string
+		text string
+		want []lsp_diagnostic
+	}{
+		{
+			name: "valid",
+			text: "dag:\n  a: []\n  b: [a]\n",
+			want: []lsp_diagnostic{},
+		},
+		{
+			name: "unknown dependency",
+			text: "dag:\n  a: []\n  b: [a, c]\n",
+			want: []lsp_diagnostic{{Range: span(2, 9, 10), Severity: severity_error, Source: "dag", Message: `task "b" depends on unknown task "c"`}},
+		},
+		{
+			name: "escaped unknown dependency",
+			text: "dag:\n  d: [\"x\\\"y\"]\n",
+			want: []lsp_diagnostic{{Range: span(1, 7, 11), Severity: severity_error, Source: "dag", Message: `task "d" depends on unknown task "x\"y"`}},
+		},
+		{
+			name: "cycle",
+			text: "dag:\n  a: [b]\n  b: [a]\n",
+			want: []lsp_diagnostic{
+				{Range: span(1, 6, 7), Severity: severity_error, Source: "dag", Message: "dependency cycle: a -> b -> a"},
+				{Range: span(2, 6, 7), Severity: severity_error, Source: "dag", Message: "dependency cycle: a -> b -> a"},
+			},
+		},
+		{
+			name: "tags of an unknown task",
+			text: "dag:\n  a: []\ntags:\n  'b''s': [ci]\n",
+			want: []lsp_diagnostic{{Range: span(3, 3, 7), Severity: severity_warning, Source: "dag", Message: `tags of unknown task "b's"`}},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got := new_test_lsp().open(t, test.text)
+			if !reflect.DeepEqual(got, test.want) {
+				t.Errorf("got %+v\nwant %+v", got, test.want)
+			}
+		})
+	}
+}
+
+func Test_lsp_did_change_updates_diagnostics(t *testing.T) {
+	lsp := new_test_lsp()
+	if diagnostics := lsp.open(t, "dag:\n  a: [b]\n"); len(diagnostics) != 1 {
+		t.Fatalf("unknown dependency: got %+v", diagnostics)
+	}
+	if diagnostics := lsp.open(t, "dag:\n  a: [b]\n  b: []\n"); len(diagnostics) != 0 {
+		t.Errorf("after defining b: got %+v, want none", diagnostics)
+	}
+	if diagnostics := lsp.open(t, "dag:\n  a: [b\n"); len(diagnostics) != 1 || diagnostics[0].Severity != severity_error {
+		t.Errorf("syntax error: got %+v, want one error", diagnostics)
+	}
+}
+
+func Test_lsp_hover(t *testing.T) {
+	lsp := new_test_lsp()
+	lsp.open(t, "dag:\n  a: []\n  b: [a]\n  c: [a, b]\n")
+	tests := []struct {
+		position map[string]any
+		want     string
+	}{
+		{at(1, 2), "**a** · level 1\n\ndepends on nothing\n\nneeded by `b`, `c`"},
+		{at(3, 9), "**b** · level 2\n\ndepends on `a`\n\nneeded by `c`"},
+		{at(3, 2), "**c** · level 3\n\ndepends on `a`, `b`\n\nneeded by nothing"},
+	}
+	for _, test := range tests {
+		var hover struct {
+			Contents struct {
+				Kind  string `json:"kind"`
+				Value string `json:"value"`
+			} `json:"contents"`
+		}
+		lsp.call(t, "textDocument/hover", test.position, &hover)
+		if hover.Contents.Kind != "markdown" || hover.Contents.Value != test.want {
+			t.Errorf("%v: got %+v, want %q", test.position["position"], hover.Contents, test.want)
+		}
+	}
+
+	var nothing any
+	lsp.call(t, "textDocument/hover", at(0, 1), &nothing)
+	if nothing != nil {
+		t.Errorf("hover on dag: got %v, want null", nothing)
+	}
+}
+
+func Test_lsp_definition(t *testing.T) {
+	lsp := new_test_lsp()
+	lsp.open(t, "dag:\n  \"a\\\"b\": []\n  'c''d': []\n  e: [\"a\\\"b\", 'c''d', missing]\n")
+	tests := []struct {
+		position map[string]any
+		want     []lsp_location
+	}{
+		{at(3, 7), []lsp_location{{Uri: test_lsp_uri, Range: lsp_range{Start: lsp_position{Line: 1, Character: 3}, End: lsp_position{Line: 1, Character: 7}}}}},
+		{at(3, 17), []lsp_location{{Uri: test_lsp_uri, Range: lsp_range{Start: lsp_position{Line: 2, Character: 3}, End: lsp_position{Line: 2, Character: 7}}}}},
+		{at(3, 23), []lsp_location{}},
+	}
+	for _, test := range tests {
+		var got []lsp_location
+		lsp.call(t, "textDocument/definition", test.position, &got)
+		if !reflect.DeepEqual(got, test.want) {
+			t.Errorf("%v: got %+v, want %+v", test.position["position"], got, test.want)
+		}
+	}
+}
+
+func Test_lsp_completion(t *testing.T) {
+	defined := "dag:\n  a: []\n  b: []\n  c: []\n  d: [c]\n"
+	tests := []struct {
+		name     string
+		text     string
+		position map[string]any
+		want     []string
+	}{
+		{"flow list", defined + "  e: [a, ", at(5, 9), []string{"b", "c", "d"}},
+		{"before later items", defined + "  e: [, b]", at(5, 6), []string{"a", "c", "d"}},
+		{"quoted items", defined + "  e: [\"a\", 'b', ", at(5, 16), []string{"c", "d"}},
+		{"block list", defined + "  e:\n    - b\n    - \n    - d\n", at(7, 6), []string{"a", "c"}},
+		{"no cycles", "dag:\n  a:\n    - \n  b: [a]\n  c: [b]\n  a2: []\n", at(2, 6), []string{"a2"}},
+		{"outside a list", defined, at(1, 2), []string{}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			lsp := new_test_lsp()
+			lsp.open(t, defined)
+			lsp.open(t, test.text)
+			var items []lsp_completion_item
+			lsp.call(t, "textDocument/completion", test.position, &items)
+			labels := []string{}
+			for _, item := range items {
+				labels = append(labels, item.Label)
+			}
+			if !reflect.DeepEqual(labels, test.want) {
+				t.Errorf("got %q, want %q", labels, test.want)
+			}
+		})
+	}
+}
+
+func Test_lsp_requests_need_an_open_document(t *testing.T) {
+	lsp := new_test_lsp()
+	messages := lsp.send(t, "textDocument/hover", at(0, 0), true)
+	if len(messages) != 1 || messages[0].Error == nil || messages[0].Error.Code != rpc_invalid_params {
+		t.Errorf("got %+v, want an invalid params error", messages)
+	}
+	messages = lsp.send(t, "workspace/symbol", map[string]any{}, true)
+	if len(messages) != 1 || messages[0].Error == nil || messages[0].Error.Code != rpc_method_not_found {
+		t.Errorf("got %+v, want a method not found error", messages)
+	}
+}
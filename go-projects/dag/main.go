@@ -1,53 +1,100 @@
 package main
 
 import (
+	"flag"
 	"fmt"
-	"log"
 	"os"
-	"path/filepath"
+	"strings"
 
-	"gopkg.in/yaml.v3"
-	"github.com/PeterCullenBurbery/go_functions_002/v3/system_management_functions"
 	"github.com/PeterCullenBurbery/go_functions_002/v3/math_functions"
 )
 
 type dag_file struct {
-	Dag map[string][]string `yaml:"dag"`
+	Dag    map[string][]string     `yaml:"dag"`
+	Tags   map[string][]string     `yaml:"tags"`
+	Run    map[string]task_command `yaml:"run"`
+	Policy map[string]string       `yaml:"policy"`
 }
 
 func main() {
-	// Step 1: Convert blob URL to raw
-	raw_url, err := system_management_functions.Convert_blob_to_raw_github_url(
-		"https://github.com/PeterCullenBurbery/dag/blob/main/dag.yaml",
-	)
-	if err != nil {
-		log.Fatalf("❌ url_conversion_failed: %v", err)
-	}
+	configure_logging()
 
-	// Step 2: Download dag.yaml
-	local_path := filepath.Join(os.TempDir(), "dag.yaml")
-	err = system_management_functions.Download_file(local_path, raw_url)
-	if err != nil {
-		log.Fatalf("❌ download_failed: %v", err)
+	// Subcommands: why, paths, query, hubs, keygen, sign, lock, run, serve, tui, history, stats, logs, schema, lsp, export, import
+	if len(os.Args) > 1 && !strings.HasPrefix(os.Args[1], "-") {
+		switch os.Args[1] {
+		case "why":
+			run_why(os.Args[2:])
+		case "paths":
+			run_paths(os.Args[2:])
+		case "query":
+			run_query(os.Args[2:])
+		case "hubs":
+			run_hubs(os.Args[2:])
+		case "keygen":
+			run_keygen(os.Args[2:])
+		case "sign":
+			run_sign(os.Args[2:])
+		case "lock":
+			run_lock(os.Args[2:])
+		case "run":
+			run_run(os.Args[2:])
+		case "serve":
+			run_serve(os.Args[2:])
+		case "tui":
+			run_tui(os.Args[2:])
+		case "history":
+			run_history(os.Args[2:])
+		case "stats":
+			run_stats(os.Args[2:])
+		case "logs":
+			run_logs(os.Args[2:])
+		case "schema":
+			run_schema(os.Args[2:])
+		case "lsp":
+			run_lsp(os.Args[2:])
+		case "export":
+			run_export(os.Args[2:])
+		case "import":
+			run_import(os.Args[2:])
+		default:
+			fatal_usage("unknown_command", "command", os.Args[1])
+		}
+		return
 	}
 
-	// Step 3: Load and parse YAML
-	file_content, err := os.ReadFile(local_path)
-	if err != nil {
-		log.Fatalf("❌ file_read_failed: %v", err)
-	}
+	run_order(os.Args[1:])
+}
+
+// run_order prints the reverse topological execution order of the whole DAG, the command without a subcommand
+func run_order(args []string) {
+	flags := flag.NewFlagSet("dag", flag.ExitOnError)
+	add_logging_flags(flags)
+	json_output := flags.Bool("json", false, "print the tasks and the execution order as JSON")
+	add_source_flags(flags)
+	flags.Parse(args)
 
-	var parsed dag_file
-	err = yaml.Unmarshal(file_content, &parsed)
+	// Steps 1-3: Download and parse dag.yaml
+	parsed, err := load_dag_file()
 	if err != nil {
-		log.Fatalf("❌ yaml_parse_failed: %v", err)
+		fatal_error("dag_load_failed", err)
 	}
 	dag := parsed.Dag
+	if err := check_dag(dag); err != nil {
+		fatal_error("dag_invalid", err)
+	}
+	if *json_output {
+		graph, err := describe_graph(parsed)
+		if err != nil {
+			fatal_error("reverse_topological_sort_failed", err)
+		}
+		print_json(os.Stdout, graph)
+		return
+	}
 
 	// Step 4: Reverse topologically sort the DAG
 	execution_order, err := math_functions.Reverse_topological_sort(dag)
 	if err != nil {
-		log.Fatalf("❌ reverse_topological_sort_failed: %v", err)
+		fatal_error("reverse_topological_sort_failed", err)
 	}
 
 	// Step 5: Display the reverse order
@@ -55,4 +102,4 @@ func main() {
 	for i, task := range execution_order {
 		fmt.Printf("%2d. %s\n", i+1, task)
 	}
-}
\ No newline at end of file
+}
@@ -0,0 +1,134 @@
+package main
+
+import (
+	"flag"
+	"log/slog"
+	"net/http"
+	"sync"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+// duration_buckets are the upper bounds, in seconds, of the task duration histogram
+var duration_buckets = []float64{0.1, 0.5, 1, 5, 10, 30, 60, 300, 600, 1800}
+
+// run_metrics aggregates run events into Prometheus metrics
+type run_metrics struct {
+	tags     map[string][]string // task -> tags, for the tag label
+	textfile string              // rewritten after every finished task and run when not empty
+
+	textfile_mutex sync.Mutex // serialises textfile writes
+
+	registry  *prometheus.Registry
+	runs      prometheus.Counter
+	outcomes  *prometheus.CounterVec   // task, status
+	durations *prometheus.HistogramVec // task, tag
+	running   prometheus.Gauge
+	queued    prometheus.Gauge
+
+	mutex   sync.Mutex
+	started map[string]int // task -> runs in which it started and has not finished yet
+}
+
+// metrics_textfile is the --metrics-textfile path; empty disables the textfile output
+var metrics_textfile string
+
+// add_metrics_flags registers the flag that writes metrics for the node_exporter textfile collector
+func add_metrics_flags(flags *flag.FlagSet) {
+	flags.StringVar(&metrics_textfile, "metrics-textfile", "", "write Prometheus metrics to this .prom file after every task")
+}
+
+// new_run_metrics returns empty metrics labelling durations with the given task tags
+func new_run_metrics(tags map[string][]string) *run_metrics {
+	metrics := &run_metrics{
+		tags:     tags,
+		textfile: metrics_textfile,
+		registry: prometheus.NewRegistry(),
+		runs: prometheus.NewCounter(prometheus.CounterOpts{
+			Name: "dag_runs_total",
+			Help: "Runs started.",
+		}),
+		outcomes: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "dag_task_outcomes_total",
+			Help: "Finished tasks by outcome.",
+		}, []string{"task", "status"}),
+		durations: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Name:    "dag_task_duration_seconds",
+			Help:    "Duration of executed tasks.",
+			Buckets: duration_buckets,
+		}, []string{"task", "tag"}),
+		running: prometheus.NewGauge(prometheus.GaugeOpts{
+			Name: "dag_tasks_running",
+			Help: "Tasks currently running.",
+		}),
+		queued: prometheus.NewGauge(prometheus.GaugeOpts{
+			Name: "dag_tasks_queued",
+			Help: "Tasks waiting for their dependencies or a free job slot.",
+		}),
+		started: make(map[string]int),
+	}
+	metrics.registry.MustRegister(metrics.runs, metrics.outcomes, metrics.durations, metrics.running, metrics.queued)
+	return metrics
+}
+
+// record updates the metrics for one run event and refreshes the textfile; safe for concurrent use
+func (metrics *run_metrics) record(event run_event) {
+	if metrics == nil {
+		return
+	}
+	metrics.update(event)
+	if metrics.textfile != "" && (event.Type == event_task_finished || event.Type == event_run_finished) {
+		metrics.write_textfile(metrics.textfile)
+	}
+}
+
+// update applies one run event to the counters, histograms and gauges
+func (metrics *run_metrics) update(event run_event) {
+	metrics.mutex.Lock()
+	defer metrics.mutex.Unlock()
+
+	switch event.Type {
+	case event_run_started:
+		metrics.runs.Inc()
+		metrics.queued.Add(float64(event.Counts["queued"]))
+	case event_task_started:
+		metrics.queued.Dec()
+		metrics.running.Inc()
+		metrics.started[event.Task]++
+	case event_task_finished:
+		metrics.outcomes.WithLabelValues(event.Task, event.Status).Inc()
+		if metrics.started[event.Task] == 0 {
+			metrics.queued.Dec() // skipped, or cancelled before it started
+			return
+		}
+		metrics.started[event.Task]--
+		metrics.running.Dec()
+		if event.Status == status_cancelled {
+			return // interrupted: the duration says nothing about the task
+		}
+
+		// A task with several tags is observed once per tag, so that sum by (tag) stays meaningful
+		tags := metrics.tags[event.Task]
+		if len(tags) == 0 {
+			tags = []string{""}
+		}
+		for _, tag := range tags {
+			metrics.durations.WithLabelValues(event.Task, tag).Observe(event.Duration_ms / 1000)
+		}
+	}
+}
+
+// write_textfile writes the metrics to path for the node_exporter textfile collector
+func (metrics *run_metrics) write_textfile(path string) {
+	metrics.textfile_mutex.Lock()
+	defer metrics.textfile_mutex.Unlock()
+	if err := prometheus.WriteToTextfile(path, metrics.registry); err != nil {
+		slog.Warn("metrics_write_failed", "error", err)
+	}
+}
+
+// handle_metrics serves the metrics over HTTP in the format the scraper asks for
+func (metrics *run_metrics) handle_metrics(w http.ResponseWriter, r *http.Request) {
+	promhttp.HandlerFor(metrics.registry, promhttp.HandlerOpts{}).ServeHTTP(w, r)
+}
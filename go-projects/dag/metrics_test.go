@@ -0,0 +1,81 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func Test_metrics_after_run(t *testing.T) {
+	// The task name needs every escape of the text format: backslash, quote and newline
+	odd := "say \"hi\"\\\n"
+	parsed := dag_file{
+		Dag:  map[string][]string{"base": {}, odd: {"base"}},
+		Tags: map[string][]string{odd: {"ci", "slow"}},
+	}
+	server := httptest.NewServer(new_dag_server(parsed, 1, allowed_hosts("127.0.0.1:0", nil)).routes())
+	defer server.Close()
+	for id := 1; id <= 2; id++ {
+		status, body := post_run(t, server, map[string]string{"Content-Type": "application/json"}, `{}`)
+		if status != http.StatusAccepted {
+			t.Fatalf("run %d: got %d %v", id, status, body)
+		}
+		wait_for_run(t, server, id)
+	}
+
+	status, metrics := get_body(t, server, "/metrics", "")
+	if status != http.StatusOK {
+		t.Fatalf("got %d %s", status, metrics)
+	}
+	for _, line := range []string{
+		"# HELP dag_runs_total Runs started.\n# TYPE dag_runs_total counter\ndag_runs_total 2\n",
+		"# HELP dag_task_outcomes_total Finished tasks by outcome.\n# TYPE dag_task_outcomes_total counter\n",
+		`dag_task_outcomes_total{status="succeeded",task="base"} 2` + "\n",
+		`dag_task_outcomes_total{status="succeeded",task="say \"hi\"\\\n"} 2` + "\n",
+		"# TYPE dag_task_duration_seconds histogram\n",
+		`dag_task_duration_seconds_bucket{tag="",task="base",le="0.1"} 2` + "\n",
+		`dag_task_duration_seconds_count{tag="ci",task="say \"hi\"\\\n"} 2` + "\n",
+		`dag_task_duration_seconds_count{tag="slow",task="say \"hi\"\\\n"} 2` + "\n",
+		"# TYPE dag_tasks_running gauge\ndag_tasks_running 0\n",
+		"# TYPE dag_tasks_queued gauge\ndag_tasks_queued 0\n",
+	} {
+		if !strings.Contains(metrics, line) {
+			t.Errorf("/metrics lacks %q:\n%s", line, metrics)
+		}
+	}
+}
+
+func Test_metrics_textfile(t *testing.T) {
+	saved := metrics_textfile
+	t.Cleanup(func() { metrics_textfile = saved })
+	metrics_textfile = filepath.Join(t.TempDir(), "dag.prom")
+
+	metrics := new_run_metrics(nil)
+	for _, event := range []run_event{
+		{Type: event_run_started, Counts: map[string]int{"queued": 2}},
+		{Type: event_task_started, Task: "a"},
+		{Type: event_task_finished, Task: "a", Status: status_failed, Duration_ms: 700},
+		{Type: event_task_finished, Task: "b", Status: status_skipped},
+	} {
+		metrics.record(event)
+	}
+	content, err := os.ReadFile(metrics_textfile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, line := range []string{
+		`dag_task_outcomes_total{status="failed",task="a"} 1`,
+		`dag_task_outcomes_total{status="skipped",task="b"} 1`,
+		`dag_task_duration_seconds_bucket{tag="",task="a",le="0.5"} 0`,
+		`dag_task_duration_seconds_bucket{tag="",task="a",le="1"} 1`,
+		`dag_task_duration_seconds_sum{tag="",task="a"} 0.7`,
+		"dag_tasks_queued 0",
+	} {
+		if !strings.Contains(string(content), line+"\n") {
+			t.Errorf("textfile lacks %q:\n%s", line, content)
+		}
+	}
+}
@@ -0,0 +1,26 @@
+//go:build !windows
+
+package main
+
+import (
+	"os/exec"
+	"syscall"
+)
+
+// process_tree stops a command together with every process it started
+type process_tree struct{}
+
+// start_process_tree starts cmd as the leader of a new process group; cancelling the command kills the group
+func start_process_tree(cmd *exec.Cmd) (*process_tree, error) {
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+	cmd.Cancel = func() error {
+		return syscall.Kill(-cmd.Process.Pid, syscall.SIGKILL)
+	}
+	if err := cmd.Start(); err != nil {
+		return nil, err
+	}
+	return &process_tree{}, nil
+}
+
+// release frees what the tree holds once the command has finished
+func (tree *process_tree) release() {}
@@ -0,0 +1,71 @@
+package main
+
+import (
+	"log/slog"
+	"os/exec"
+	"sync"
+
+	"golang.org/x/sys/windows"
+)
+
+// process_tree stops a command together with every process it started
+type process_tree struct {
+	mutex sync.Mutex     // guards job against cmd.Cancel, which runs on the goroutine of exec.Cmd
+	job   windows.Handle // 0 until the command has joined the job object, and after release
+}
+
+// start_process_tree starts cmd inside a job object; cancelling the command terminates the job. Processes the
+// command starts before it joins the job escape it, and are left to cmd.WaitDelay.
+func start_process_tree(cmd *exec.Cmd) (*process_tree, error) {
+	tree := &process_tree{}
+	cmd.Cancel = func() error {
+		tree.mutex.Lock()
+		defer tree.mutex.Unlock()
+		if tree.job != 0 {
+			return windows.TerminateJobObject(tree.job, 1)
+		}
+		return cmd.Process.Kill()
+	}
+
+	// Created before the command starts, so that only joining it is left once the process exists
+	job, err := windows.CreateJobObject(nil, nil)
+	if err != nil {
+		slog.Debug("job_object_failed", "error", err)
+		job = 0
+	}
+	if err := cmd.Start(); err != nil {
+		if job != 0 {
+			windows.CloseHandle(job)
+		}
+		return nil, err
+	}
+	if job == 0 {
+		return tree, nil
+	}
+
+	process, err := windows.OpenProcess(windows.PROCESS_SET_QUOTA|windows.PROCESS_TERMINATE, false, uint32(cmd.Process.Pid))
+	if err == nil {
+		err = windows.AssignProcessToJobObject(job, process)
+		windows.CloseHandle(process)
+	}
+	if err != nil {
+		slog.Debug("job_object_failed", "error", err)
+		windows.CloseHandle(job)
+		return tree, nil
+	}
+	tree.mutex.Lock()
+	tree.job = job
+	tree.mutex.Unlock()
+	return tree, nil
+}
+
+// release frees what the tree holds once the command has finished. Closing the job does not stop processes
+// the command left running on purpose.
+func (tree *process_tree) release() {
+	tree.mutex.Lock()
+	defer tree.mutex.Unlock()
+	if tree.job != 0 {
+		windows.CloseHandle(tree.job)
+		tree.job = 0
+	}
+}
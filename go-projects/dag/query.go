@@ -0,0 +1,502 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// The query language is a small set algebra over tasks, modelled on bazel query:
+//
+//	"install java"            a single task (bare words need no quotes)
+//	deps(x), deps(x, n)       x and everything it depends on (at most n steps away)
+//	rdeps(x), rdeps(x, n)     x and everything that depends on it (at most n steps away)
+//	roots()                   tasks nothing depends on
+//	leaves()                  tasks without dependencies (level 1)
+//	all()                     every task
+//	level(n)                  tasks on level n, as printed by dag_level_sorted
+//	tag(t)                    tasks listed with tag t under tags: in dag.yaml
+//	somepath(a, b)            the tasks on one shortest path from a to b
+//	allpaths(a, b)            the tasks on every path from a to b: deps(a) ^ rdeps(b)
+//	x + y, x union y          union
+//	x ^ y, x intersect y      intersection
+//	x - y, x except y         difference
+//
+// Binary operators share one precedence and associate to the left; use parentheses to group.
+
+// query_token is a single lexical token of a query expression
+type query_token struct {
+	kind  string // "word", "string", "(", ")", ",", "+", "-", "^" or "eof"
+	value string
+	pos   int
+}
+
+// query_expr is a node of a parsed query expression
+type query_expr struct {
+	kind  string        // "literal", "call" or "binary"
+	value string        // task name, function name or operator
+	args  []*query_expr // call arguments or the two binary operands
+	pos   int
+}
+
+// query_context holds the graph views a query is evaluated against
+type query_context struct {
+	dag     map[string][]string
+	reverse map[string][]string
+	tags    map[string][]string
+	levels  map[string]int
+}
+
+var query_operators = map[string]string{
+	"+":         "+",
+	"union":     "+",
+	"^":         "^",
+	"intersect": "^",
+	"-":         "-",
+	"except":    "-",
+}
+
+// run_query evaluates a query expression and prints the matching tasks
+func run_query(args []string) {
+	flags := flag.NewFlagSet("query", flag.ExitOnError)
+	add_logging_flags(flags)
+	add_source_flags(flags)
+	flags.Parse(args)
+
+	if flags.NArg() != 1 {
+		fatal_usage("usage", "usage", "dag query EXPRESSION")
+	}
+
+	expr, err := parse_query(flags.Arg(0))
+	if err != nil {
+		fatal_error("query_parse_failed", err)
+	}
+
+	parsed, err := load_dag_file()
+	if err != nil {
+		fatal_error("dag_load_failed", err)
+	}
+	if err := check_dag(parsed.Dag); err != nil {
+		fatal_error("dag_invalid", err)
+	}
+	ctx := &query_context{
+		dag:     parsed.Dag,
+		reverse: build_reverse_graph(parsed.Dag),
+		tags:    parsed.Tags,
+		levels:  compute_levels(parsed.Dag),
+	}
+
+	result, err := evaluate_query(expr, ctx)
+	if err != nil {
+		fatal_error("query_evaluation_failed", err)
+	}
+
+	for _, task := range set_to_sorted_list(result) {
+		fmt.Println(task)
+	}
+}
+
+// tokenize_query splits a query expression into tokens
+func tokenize_query(input string) ([]query_token, error) {
+	var tokens []query_token
+	runes := []rune(input)
+	i := 0
+	for i < len(runes) {
+		r := runes[i]
+		switch {
+		case unicode.IsSpace(r):
+			i++
+		case strings.ContainsRune("(),+-^", r):
+			tokens = append(tokens, query_token{kind: string(r), value: string(r), pos: i})
+			i++
+		case r == '"' || r == '\'':
+			start := i
+			i++
+			for i < len(runes) && runes[i] != r {
+				i++
+			}
+			if i >= len(runes) {
+				return nil, query_error(start, "unterminated string")
+			}
+			tokens = append(tokens, query_token{kind: "string", value: string(runes[start+1 : i]), pos: start})
+			i++
+		case is_query_word_rune(r):
+			start := i
+			for i < len(runes) && (is_query_word_rune(runes[i]) || runes[i] == '-') {
+				i++
+			}
+			tokens = append(tokens, query_token{kind: "word", value: string(runes[start:i]), pos: start})
+		default:
+			return nil, query_error(i, "unexpected character %q", r)
+		}
+	}
+	tokens = append(tokens, query_token{kind: "eof", pos: len(runes)})
+	return tokens, nil
+}
+
+// is_query_word_rune reports whether r may appear in an unquoted word
+func is_query_word_rune(r rune) bool {
+	return unicode.IsLetter(r) || unicode.IsDigit(r) || strings.ContainsRune("_.:/@", r)
+}
+
+// parse_query parses a query expression into a tree
+func parse_query(input string) (*query_expr, error) {
+	tokens, err := tokenize_query(input)
+	if err != nil {
+		return nil, err
+	}
+
+	pos := 0
+	peek := func() query_token { return tokens[pos] }
+	next := func() query_token {
+		tok := tokens[pos]
+		if tok.kind != "eof" {
+			pos++
+		}
+		return tok
+	}
+	expect := func(kind string) (query_token, error) {
+		tok := next()
+		if tok.kind != kind {
+			return tok, query_error(tok.pos, "expected %q, found %s", kind, describe_token(tok))
+		}
+		return tok, nil
+	}
+
+	var parse_expr func() (*query_expr, error)
+
+	parse_term := func() (*query_expr, error) {
+		tok := next()
+		switch tok.kind {
+		case "(":
+			inner, err := parse_expr()
+			if err != nil {
+				return nil, err
+			}
+			if _, err := expect(")"); err != nil {
+				return nil, err
+			}
+			return inner, nil
+		case "string":
+			return &query_expr{kind: "literal", value: tok.value, pos: tok.pos}, nil
+		case "word":
+			if peek().kind != "(" {
+				return &query_expr{kind: "literal", value: tok.value, pos: tok.pos}, nil
+			}
+			next()
+			call := &query_expr{kind: "call", value: tok.value, pos: tok.pos}
+			if peek().kind == ")" {
+				next()
+				return call, nil
+			}
+			for {
+				arg, err := parse_expr()
+				if err != nil {
+					return nil, err
+				}
+				call.args = append(call.args, arg)
+				if peek().kind == "," {
+					next()
+					continue
+				}
+				if _, err := expect(")"); err != nil {
+					return nil, err
+				}
+				return call, nil
+			}
+		}
+		return nil, query_error(tok.pos, "unexpected %s", describe_token(tok))
+	}
+
+	parse_expr = func() (*query_expr, error) {
+		left, err := parse_term()
+		if err != nil {
+			return nil, err
+		}
+		for {
+			tok := peek()
+			if tok.kind == "string" {
+				break
+			}
+			op, ok := query_operators[tok.value]
+			if !ok {
+				break
+			}
+			next()
+			right, err := parse_term()
+			if err != nil {
+				return nil, err
+			}
+			left = &query_expr{kind: "binary", value: op, args: []*query_expr{left, right}, pos: tok.pos}
+		}
+		return left, nil
+	}
+
+	expr, err := parse_expr()
+	if err != nil {
+		return nil, err
+	}
+	if tok := peek(); tok.kind != "eof" {
+		return nil, query_error(tok.pos, "unexpected %s", describe_token(tok))
+	}
+	return expr, nil
+}
+
+// query_error reports an invalid query as an *ErrParse at the 0-based rune position pos
+func query_error(pos int, format string, args ...any) *ErrParse {
+	return &ErrParse{Location: "query", Line: 1, Column: pos + 1, Message: fmt.Sprintf(format, args...)}
+}
+
+// describe_token renders a token for error messages
+func describe_token(tok query_token) string {
+	switch tok.kind {
+	case "eof":
+		return "end of input"
+	case "word", "string":
+		return fmt.Sprintf("%q", tok.value)
+	}
+	return fmt.Sprintf("'%s'", tok.kind)
+}
+
+// evaluate_query evaluates a parsed query to the set of matching tasks
+func evaluate_query(expr *query_expr, ctx *query_context) (map[string]bool, error) {
+	switch expr.kind {
+	case "literal":
+		if _, ok := ctx.dag[expr.value]; !ok {
+			return nil, fmt.Errorf("%w: %q at position %d", ErrUnknownTask, expr.value, expr.pos)
+		}
+		return map[string]bool{expr.value: true}, nil
+
+	case "binary":
+		left, err := evaluate_query(expr.args[0], ctx)
+		if err != nil {
+			return nil, err
+		}
+		right, err := evaluate_query(expr.args[1], ctx)
+		if err != nil {
+			return nil, err
+		}
+		result := make(map[string]bool)
+		switch expr.value {
+		case "+":
+			for task := range left {
+				result[task] = true
+			}
+			for task := range right {
+				result[task] = true
+			}
+		case "^":
+			for task := range left {
+				if right[task] {
+					result[task] = true
+				}
+			}
+		case "-":
+			for task := range left {
+				if !right[task] {
+					result[task] = true
+				}
+			}
+		}
+		return result, nil
+
+	case "call":
+		return evaluate_query_call(expr, ctx)
+	}
+	return nil, query_error(expr.pos, "invalid expression")
+}
+
+// evaluate_query_call evaluates a function call such as deps(x) or level(2)
+func evaluate_query_call(expr *query_expr, ctx *query_context) (map[string]bool, error) {
+	check_arity := func(min int, max int) error {
+		if len(expr.args) < min || len(expr.args) > max {
+			if min == max {
+				return query_error(expr.pos, "%s() takes %d argument(s)", expr.value, min)
+			}
+			return query_error(expr.pos, "%s() takes %d to %d arguments", expr.value, min, max)
+		}
+		return nil
+	}
+
+	switch expr.value {
+	case "deps", "rdeps":
+		if err := check_arity(1, 2); err != nil {
+			return nil, err
+		}
+		start, err := evaluate_query(expr.args[0], ctx)
+		if err != nil {
+			return nil, err
+		}
+		max_depth := -1
+		if len(expr.args) == 2 {
+			max_depth, err = query_int_argument(expr.args[1])
+			if err != nil {
+				return nil, err
+			}
+		}
+		graph := ctx.dag
+		if expr.value == "rdeps" {
+			graph = ctx.reverse
+		}
+		return expand_within_depth(start, graph, max_depth), nil
+
+	case "roots", "leaves", "all":
+		if err := check_arity(0, 0); err != nil {
+			return nil, err
+		}
+		result := make(map[string]bool)
+		for task, deps := range ctx.dag {
+			switch {
+			case expr.value == "roots" && len(ctx.reverse[task]) == 0,
+				expr.value == "leaves" && len(deps) == 0,
+				expr.value == "all":
+				result[task] = true
+			}
+		}
+		return result, nil
+
+	case "level":
+		if err := check_arity(1, 1); err != nil {
+			return nil, err
+		}
+		level, err := query_int_argument(expr.args[0])
+		if err != nil {
+			return nil, err
+		}
+		result := make(map[string]bool)
+		for task, lvl := range ctx.levels {
+			if lvl == level {
+				result[task] = true
+			}
+		}
+		return result, nil
+
+	case "tag":
+		if err := check_arity(1, 1); err != nil {
+			return nil, err
+		}
+		if expr.args[0].kind != "literal" {
+			return nil, query_error(expr.args[0].pos, "tag() expects a tag name")
+		}
+		result := make(map[string]bool)
+		for task, tags := range ctx.tags {
+			for _, tag := range tags {
+				if tag == expr.args[0].value {
+					result[task] = true
+				}
+			}
+		}
+		return result, nil
+
+	case "somepath", "allpaths":
+		if err := check_arity(2, 2); err != nil {
+			return nil, err
+		}
+		from, err := evaluate_query(expr.args[0], ctx)
+		if err != nil {
+			return nil, err
+		}
+		to, err := evaluate_query(expr.args[1], ctx)
+		if err != nil {
+			return nil, err
+		}
+		result := make(map[string]bool)
+		if expr.value == "somepath" {
+			// One breadth-first search per source: polynomial even on dense graphs
+			var shortest []string
+			for _, source := range set_to_sorted_list(from) {
+				if path := shortest_path(source, to, ctx.dag); path != nil && (shortest == nil || len(path) < len(shortest)) {
+					shortest = path
+				}
+			}
+			for _, task := range shortest {
+				result[task] = true
+			}
+			return result, nil
+		}
+		// A task lies on a path from some a to some b exactly when some a reaches it and it reaches some b
+		reached := expand_within_depth(from, ctx.dag, -1)
+		for task := range expand_within_depth(to, ctx.reverse, -1) {
+			if reached[task] {
+				result[task] = true
+			}
+		}
+		return result, nil
+	}
+	return nil, query_error(expr.pos, "unknown function %s()", expr.value)
+}
+
+// shortest_path returns a shortest dependency path from source to any of targets, or nil if none is reachable.
+// Neighbours are visited in alphabetical order, so ties resolve the same way on every run.
+func shortest_path(source string, targets map[string]bool, dag map[string][]string) []string {
+	previous := map[string]string{source: ""}
+	queue := []string{source}
+	for len(queue) > 0 {
+		current := queue[0]
+		queue = queue[1:]
+		deps := append([]string(nil), dag[current]...)
+		sort.Strings(deps)
+		for _, dep := range deps {
+			if _, seen := previous[dep]; seen {
+				continue
+			}
+			previous[dep] = current
+			if targets[dep] {
+				path := []string{dep}
+				for node := current; node != ""; node = previous[node] {
+					path = append([]string{node}, path...)
+				}
+				return path
+			}
+			queue = append(queue, dep)
+		}
+	}
+	return nil
+}
+
+// query_int_argument reads a non-negative integer literal argument
+func query_int_argument(arg *query_expr) (int, error) {
+	if arg.kind == "literal" {
+		if n, err := strconv.Atoi(arg.value); err == nil && n >= 0 {
+			return n, nil
+		}
+	}
+	return 0, query_error(arg.pos, "expected a non-negative integer")
+}
+
+// expand_within_depth returns start plus every task reachable through graph in at most max_depth steps.
+// A negative max_depth means no limit.
+func expand_within_depth(start map[string]bool, graph map[string][]string, max_depth int) map[string]bool {
+	result := make(map[string]bool)
+	var frontier []string
+	for task := range start {
+		result[task] = true
+		frontier = append(frontier, task)
+	}
+	for depth := 0; len(frontier) > 0 && (max_depth < 0 || depth < max_depth); depth++ {
+		var next_frontier []string
+		for _, task := range frontier {
+			for _, neighbour := range graph[task] {
+				if !result[neighbour] {
+					result[neighbour] = true
+					next_frontier = append(next_frontier, neighbour)
+				}
+			}
+		}
+		frontier = next_frontier
+	}
+	return result
+}
+
+// set_to_sorted_list returns the members of a task set in lexical order
+func set_to_sorted_list(set map[string]bool) []string {
+	list := make([]string, 0, len(set))
+	for task := range set {
+		list = append(list, task)
+	}
+	sort.Strings(list)
+	return list
+}
@@ -0,0 +1,132 @@
+package main
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+)
+
+// test_query_context evaluates queries against the diamond plus a task outside it
+func test_query_context(dag map[string][]string) *query_context {
+	return &query_context{
+		dag:     dag,
+		reverse: build_reverse_graph(dag),
+		tags:    map[string][]string{"left": {"ui"}, "right": {"ui", "api"}},
+		levels:  compute_levels(dag),
+	}
+}
+
+func Test_query(t *testing.T) {
+	dag := map[string][]string{"island": {}}
+	for task, deps := range diamond_dag {
+		dag[task] = deps
+	}
+	ctx := test_query_context(dag)
+	tests := []struct {
+		query string
+		want  []string
+	}{
+		{"top", []string{"top"}},
+		{`"left" union 'right'`, []string{"left", "right"}},
+		// One precedence, left to right
+		{"left + right ^ right", []string{"right"}},
+		{"left + (right ^ right)", []string{"left", "right"}},
+		{"deps(top) - left + right", []string{"base", "right", "top"}},
+		{"deps(top) - (left + right)", []string{"base", "top"}},
+		{"all() except deps(top)", []string{"island"}},
+		{"left intersect right", []string{}},
+		{"deps(left)", []string{"base", "left"}},
+		{"deps(top, 0)", []string{"top"}},
+		{"deps(top, 1)", []string{"base", "left", "right", "top"}},
+		{"rdeps(left)", []string{"left", "top"}},
+		{"rdeps(base, 1)", []string{"base", "left", "right", "top"}},
+		{"rdeps(base) ^ deps(top)", []string{"base", "left", "right", "top"}},
+		{"roots()", []string{"island", "top"}},
+		{"leaves()", []string{"base", "island"}},
+		{"tag(ui) - tag(api)", []string{"left"}},
+		{"somepath(top, base)", []string{"base", "top"}},
+		{"somepath(top, left + right)", []string{"left", "top"}},
+		{"somepath(base, top)", []string{}},
+		{"allpaths(top, base)", []string{"base", "left", "right", "top"}},
+		{"allpaths(top, left)", []string{"left", "top"}},
+		{"allpaths(left, right)", []string{}},
+		{"allpaths(island, base)", []string{}},
+	}
+	for _, test := range tests {
+		t.Run(test.query, func(t *testing.T) {
+			expr, err := parse_query(test.query)
+			if err != nil {
+				t.Fatal(err)
+			}
+			result, err := evaluate_query(expr, ctx)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := set_to_sorted_list(result); !reflect.DeepEqual(got, test.want) {
+				t.Errorf("got %v, want %v", got, test.want)
+			}
+		})
+	}
+}
+
+func Test_query_errors(t *testing.T) {
+	ctx := test_query_context(diamond_dag)
+	tests := []struct {
+		query  string
+		column int // of the *ErrParse; 0 for ErrUnknownTask
+	}{
+		{"deps(top", 9},
+		{"top +", 6},
+		{"(left", 6},
+		{"left)", 5},
+		{"'left", 1},
+		{"left $ right", 6},
+		{"deps()", 1},
+		{"level(x)", 7},
+		{"deps(top, -1)", 11},
+		{"nosuch(top)", 1},
+		{"tag(deps(top))", 5},
+		{"missing", 0},
+		{"deps(top) + missing", 0},
+	}
+	for _, test := range tests {
+		t.Run(test.query, func(t *testing.T) {
+			expr, err := parse_query(test.query)
+			if err == nil {
+				_, err = evaluate_query(expr, ctx)
+			}
+			if test.column == 0 {
+				if !errors.Is(err, ErrUnknownTask) {
+					t.Errorf("got %v, want ErrUnknownTask", err)
+				}
+				return
+			}
+			var parse_error *ErrParse
+			if !errors.As(err, &parse_error) {
+				t.Fatalf("got %v, want *ErrParse", err)
+			}
+			if parse_error.Column != test.column {
+				t.Errorf("%v: column %d, want %d", err, parse_error.Column, test.column)
+			}
+			if exit_code(err) != exit_parse {
+				t.Errorf("exit code %d, want %d", exit_code(err), exit_parse)
+			}
+		})
+	}
+}
+
+// Test_query_allpaths_wide evaluates allpaths on a ladder with 2^40 paths
+func Test_query_allpaths_wide(t *testing.T) {
+	ctx := test_query_context(ladder_dag(40))
+	expr, err := parse_query("allpaths(top, bottom)")
+	if err != nil {
+		t.Fatal(err)
+	}
+	result, err := evaluate_query(expr, ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(result) != len(ctx.dag) {
+		t.Errorf("got %d tasks, want all %d", len(result), len(ctx.dag))
+	}
+}
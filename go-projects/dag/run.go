@@ -0,0 +1,431 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"os/signal"
+	"slices"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Task statuses reported by a run
+const (
+	status_succeeded = "succeeded"
+	status_failed    = "failed"
+	status_skipped   = "skipped"
+	status_cancelled = "cancelled" // stopped or never started because a fail-fast task failed or the run was interrupted
+)
+
+// cancelled_by_interrupt is the blocked_by of tasks cancelled through run_options.ctx rather than by a fail-fast task
+const cancelled_by_interrupt = "interrupt"
+
+// Failure policies, run-wide with dag run --on-failure and per task in the policy: section of dag.yaml
+const (
+	policy_continue      = "continue"      // skip the dependents of the failed task, run all independent work
+	policy_fail_fast     = "fail-fast"     // cancel every running task and start nothing more
+	policy_allow_failure = "allow-failure" // report the failure, but let dependents run as if the task succeeded
+)
+
+// failure_policies lists the valid policies for error messages
+var failure_policies = []string{policy_continue, policy_fail_fast, policy_allow_failure}
+
+// run_options configures execute_plan
+type run_options struct {
+	commands map[string]task_command // task -> what it runs
+	executor Executor                // runs the commands; new_executor(exec_runner{}) when nil
+	jobs     int                     // maximum number of tasks running at the same time
+	console  io.Writer               // progress lines and command output
+	publish  func(run_event)         // progress events; must be safe for concurrent use
+	logs_dir string                  // per-task log files are written here when not empty
+	policy   string                  // run-wide failure policy; policy_continue when empty
+	policies map[string]string       // task -> failure policy overriding policy
+	ctx      context.Context         // cancelling it stops the run; context.Background() when nil
+}
+
+// policy_of returns the failure policy of task
+func (options run_options) policy_of(task string) string {
+	if policy := options.policies[task]; policy != "" {
+		return policy
+	}
+	if options.policy != "" {
+		return options.policy
+	}
+	return policy_continue
+}
+
+// task_result is the outcome of one task in a run
+type task_result struct {
+	task       string
+	status     string
+	err        error
+	duration   time.Duration
+	blocked_by string // for skipped and cancelled tasks: the failed task that blocked them
+	allowed    bool   // for failed tasks: the allow-failure policy let their dependents run
+}
+
+// run_run executes the tasks of dag.yaml in dependency order
+func run_run(args []string) {
+	flags := flag.NewFlagSet("run", flag.ExitOnError)
+	add_logging_flags(flags)
+	locked := flags.Bool("locked", false, "refuse to run if the source no longer matches the lock file")
+	lock_path := flags.String("lock", "dag.lock", "lock file checked by --locked")
+	jobs := flags.Int("jobs", 1, "maximum number of tasks to run at the same time")
+	events_path := flags.String("events", "", "append run events to this file as newline-delimited JSON")
+	dry_run := flags.Bool("dry-run", false, "print the program each task would run instead of running it")
+	on_failure := flags.String("on-failure", policy_continue, "failure policy for tasks without one in dag.yaml: "+strings.Join(failure_policies, ", "))
+	add_source_flags(flags)
+	add_history_flags(flags)
+	add_metrics_flags(flags)
+	add_task_log_flags(flags)
+	flags.Parse(args)
+
+	if *jobs < 1 {
+		fatal_usage("invalid_jobs", "jobs", *jobs)
+	}
+	if !slices.Contains(failure_policies, *on_failure) {
+		fatal_usage("invalid_failure_policy", "on_failure", *on_failure, "policies", strings.Join(failure_policies, ", "))
+	}
+
+	// Step 1: Load, verify and check the DAG
+	require_fresh_source = true
+	parsed, digest, err := load_dag_source()
+	if err != nil {
+		fatal_error("dag_load_failed", err)
+	}
+	if *locked {
+		lock, err := read_lock_file(*lock_path)
+		if err == nil {
+			err = verify_lock(lock, parsed, digest)
+		}
+		if err != nil {
+			fatal_error("lock_mismatch", err)
+		}
+	}
+	if err := check_dag(parsed.Dag); err != nil {
+		fatal_error("dag_invalid", err)
+	}
+
+	// Step 2: Select the requested tasks and everything they depend on
+	selected, err := select_tasks(flags.Args(), parsed.Dag)
+	if err != nil {
+		fatal_error("unknown_task", err)
+	}
+
+	// Step 3: Execute, streaming events to --events, recording them in the history and --metrics-textfile.
+	// A dry run executes nothing and leaves no trace outside --events.
+	var executor Executor = new_executor(exec_runner{})
+	if *dry_run {
+		executor = new_executor(dry_run_runner{})
+		history_path, metrics_textfile, task_logs_dir = "", "", ""
+	}
+	bus := new_event_bus()
+	stop_events := func() {}
+	if *events_path != "" {
+		stop, err := start_ndjson_writer(*events_path, bus)
+		if err != nil {
+			fatal("events_open_failed", "error", err)
+		}
+		stop_events = stop
+	}
+	history := new_history_recorder()
+	var metrics *run_metrics
+	if metrics_textfile != "" {
+		metrics = new_run_metrics(parsed.Tags)
+	}
+	// On unix commands run in their own process group, out of reach of ctrl+c, so the interrupt cancels the run
+	ctx, stop_interrupt := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop_interrupt()
+	fmt.Printf("🚀 running %d task(s) with %d job(s)\n", len(selected), *jobs)
+	results := execute_plan(parsed.Dag, selected, run_options{
+		ctx:      ctx,
+		commands: parsed.Run,
+		executor: executor,
+		jobs:     *jobs,
+		console:  os.Stdout,
+		logs_dir: task_logs_dir,
+		policy:   *on_failure,
+		policies: parsed.Policy,
+		publish: func(event run_event) {
+			bus.publish(event)
+			history.record(event)
+			metrics.record(event)
+		},
+	})
+	stop_events()
+
+	// Step 4: Report
+	succeeded := print_run_summary(results, parsed.Dag)
+	if !succeeded {
+		os.Exit(1)
+	}
+}
+
+// select_tasks returns the targets plus their transitive dependencies, or every task when no targets are given
+func select_tasks(targets []string, dag map[string][]string) (map[string]bool, error) {
+	selected := make(map[string]bool)
+	if len(targets) == 0 {
+		for task := range dag {
+			selected[task] = true
+		}
+		return selected, nil
+	}
+	for _, target := range targets {
+		if err := check_task_exists(target, dag); err != nil {
+			return nil, err
+		}
+		selected[target] = true
+		for _, dep := range resolve_all_dependencies(target, dag) {
+			selected[dep] = true
+		}
+	}
+	return selected, nil
+}
+
+// execute_plan runs the selected tasks, starting each one once all of its dependencies have succeeded.
+// At most options.jobs tasks run at the same time; tasks whose dependencies failed are skipped.
+// A failure under fail-fast cancels the running tasks and the rest of the plan.
+func execute_plan(dag map[string][]string, selected map[string]bool, options run_options) map[string]task_result {
+	publish := options.publish
+	parent := options.ctx
+	if parent == nil {
+		parent = context.Background()
+	}
+	ctx, cancel := context.WithCancel(parent)
+	defer cancel()
+	cancelled_by := "" // the fail-fast task whose failure cancelled the run, or cancelled_by_interrupt
+	executor := options.executor
+	if executor == nil {
+		executor = new_executor(exec_runner{})
+	}
+	reverse := build_reverse_graph(dag)
+	results := make(map[string]task_result)
+
+	pending := make(map[string]int)
+	var ready []string
+	for task := range selected {
+		for _, dep := range dag[task] {
+			if selected[dep] {
+				pending[task]++
+			}
+		}
+		if pending[task] == 0 {
+			ready = append(ready, task)
+		}
+	}
+
+	publish(run_event{Type: event_run_started, Counts: map[string]int{"queued": len(selected)}})
+
+	done := make(chan task_result)
+	running := 0
+
+	complete := func(result task_result) {
+		results[result.task] = result
+		event := run_event{
+			Type:        event_task_finished,
+			Task:        result.task,
+			Status:      result.status,
+			Duration_ms: float64(result.duration.Microseconds()) / 1000,
+			Blocked_by:  result.blocked_by,
+			Allowed:     result.allowed,
+		}
+		if result.err != nil {
+			event.Error = result.err.Error()
+		}
+		publish(event)
+		for _, dependent := range reverse[result.task] {
+			if !selected[dependent] {
+				continue
+			}
+			pending[dependent]--
+			if pending[dependent] == 0 {
+				ready = append(ready, dependent)
+			}
+		}
+	}
+
+	// interrupted stops starting tasks once the caller cancelled the run
+	interrupted := func() {
+		if cancelled_by == "" && parent.Err() != nil {
+			cancelled_by = cancelled_by_interrupt
+			slog.Debug("run_cancelled", "reason", parent.Err())
+		}
+	}
+
+	for len(results) < len(selected) {
+		interrupted()
+		sort.Strings(ready)
+		for running < options.jobs && len(ready) > 0 {
+			task := ready[0]
+			ready = ready[1:]
+
+			if cancelled_by != "" {
+				fmt.Fprintf(options.console, "🛑 %s (cancelled by %s)\n", task, cancelled_by)
+				complete(task_result{task: task, status: status_cancelled, blocked_by: cancelled_by})
+				continue
+			}
+			if blocker := find_blocker(task, dag, results); blocker != "" {
+				fmt.Fprintf(options.console, "⏭️ %s (blocked by %s)\n", task, blocker)
+				slog.Debug("task_skipped", "task", task, "blocked_by", blocker)
+				complete(task_result{task: task, status: status_skipped, blocked_by: blocker})
+				continue
+			}
+
+			running++
+			fmt.Fprintf(options.console, "▶️ %s\n", task)
+			publish(run_event{Type: event_task_started, Task: task})
+			go func(task string) {
+				start := time.Now()
+				command := options.commands[task]
+				output := &event_line_writer{task: task, publish: publish}
+				writers := []io.Writer{options.console, output}
+				var log_file *os.File
+				if options.logs_dir != "" {
+					file, err := open_task_log(options.logs_dir, task, command.script(), start)
+					if err != nil {
+						slog.Warn("task_log_failed", "task", task, "error", err)
+					} else {
+						log_file = file
+						writers = append(writers, file)
+					}
+				}
+				slog.Debug("task_started", "task", task, "kind", command.Kind, "command", command.script())
+
+				err := executor.Execute(ctx, task, command, io.MultiWriter(writers...))
+				output.flush()
+				result := task_result{task: task, status: status_succeeded, duration: time.Since(start)}
+				switch {
+				case err != nil && ctx.Err() != nil:
+					result.status = status_cancelled
+					result.err = err
+				case err != nil:
+					result.status = status_failed
+					result.err = err
+					result.allowed = options.policy_of(task) == policy_allow_failure
+				}
+				if log_file != nil {
+					close_task_log(log_file, result)
+				}
+				slog.Debug("task_finished", "task", task, "status", result.status, "duration", result.duration)
+				done <- result
+			}(task)
+		}
+
+		if running == 0 {
+			continue
+		}
+		result := <-done
+		running--
+		interrupted()
+		duration := result.duration.Round(time.Millisecond)
+		switch {
+		case result.status == status_cancelled:
+			result.blocked_by = cancelled_by
+			fmt.Fprintf(options.console, "🛑 %s (%s): cancelled by %s\n", result.task, duration, cancelled_by)
+		case result.allowed:
+			fmt.Fprintf(options.console, "⚠️ %s (%s): %v (allowed to fail)\n", result.task, duration, result.err)
+		case result.err != nil:
+			fmt.Fprintf(options.console, "❌ %s (%s): %v\n", result.task, duration, result.err)
+			if options.policy_of(result.task) == policy_fail_fast && cancelled_by == "" {
+				cancelled_by = result.task
+				slog.Debug("run_cancelled", "task", result.task)
+				cancel()
+			}
+		default:
+			fmt.Fprintf(options.console, "✅ %s (%s)\n", result.task, duration)
+		}
+		complete(result)
+	}
+
+	counts := make(map[string]int)
+	for _, result := range results {
+		counts[result.status]++
+	}
+	publish(run_event{Type: event_run_finished, Counts: counts})
+	return results
+}
+
+// find_blocker returns the failed task that prevents task from running, or "" if all dependencies succeeded
+// or were allowed to fail
+func find_blocker(task string, dag map[string][]string, results map[string]task_result) string {
+	for _, dep := range dag[task] {
+		result, ok := results[dep]
+		if !ok {
+			continue
+		}
+		switch {
+		case result.status == status_failed && !result.allowed:
+			return dep
+		case result.status == status_skipped:
+			return result.blocked_by
+		}
+	}
+	return ""
+}
+
+// print_run_summary prints the outcome of a run and reports whether it succeeded: every task succeeded
+// or was allowed to fail. Each failure lists the tasks it blocked, found through the reverse graph.
+func print_run_summary(results map[string]task_result, dag map[string][]string) bool {
+	counts := make(map[string]int)
+	allowed := 0
+	var failed, cancelled []string
+	for task, result := range results {
+		counts[result.status]++
+		switch result.status {
+		case status_failed:
+			failed = append(failed, task)
+			if result.allowed {
+				allowed++
+			}
+		case status_cancelled:
+			cancelled = append(cancelled, task)
+		}
+	}
+	sort.Strings(failed)
+	sort.Strings(cancelled)
+
+	fmt.Printf("\n📋 %d succeeded, %d failed (%d allowed), %d skipped, %d cancelled\n",
+		counts[status_succeeded], counts[status_failed], allowed, counts[status_skipped], counts[status_cancelled])
+	reverse := build_reverse_graph(dag)
+	for _, task := range failed {
+		if results[task].allowed {
+			fmt.Printf("  ⚠️ %s: %v (allowed to fail)\n", task, results[task].err)
+			continue
+		}
+		fmt.Printf("  ❌ %s: %v\n", task, results[task].err)
+		if blocked := blocked_dependents(task, reverse, results); len(blocked) > 0 {
+			fmt.Printf("     ⏭️ blocked %d: %s\n", len(blocked), strings.Join(blocked, ", "))
+		}
+	}
+	for _, task := range cancelled {
+		fmt.Printf("  🛑 %s (cancelled by %s)\n", task, results[task].blocked_by)
+	}
+	return counts[status_failed] == allowed && counts[status_skipped] == 0 && counts[status_cancelled] == 0
+}
+
+// blocked_dependents returns, in alphabetical order, the dependents of a failed task that were skipped:
+// the transitive dependents in the reverse graph, not crossing tasks that still ran
+func blocked_dependents(task string, reverse map[string][]string, results map[string]task_result) []string {
+	seen := make(map[string]bool)
+	var blocked []string
+	queue := []string{task}
+	for len(queue) > 0 {
+		current := queue[0]
+		queue = queue[1:]
+		for _, dependent := range reverse[current] {
+			if seen[dependent] || results[dependent].status != status_skipped {
+				continue
+			}
+			seen[dependent] = true
+			blocked = append(blocked, dependent)
+			queue = append(queue, dependent)
+		}
+	}
+	sort.Strings(blocked)
+	return blocked
+}
@@ -0,0 +1,45 @@
+package main
+
+import (
+	"context"
+	"io"
+	"testing"
+)
+
+// blocking_executor runs every task until the run is cancelled, announcing each start on started
+type blocking_executor struct {
+	started chan string
+}
+
+func (executor blocking_executor) Execute(ctx context.Context, task string, command task_command, output io.Writer) error {
+	executor.started <- task
+	<-ctx.Done()
+	return ctx.Err()
+}
+
+func Test_execute_plan_cancelled_by_caller(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	executor := blocking_executor{started: make(chan string, len(diamond_dag))}
+	go func() {
+		<-executor.started // base
+		cancel()
+	}()
+	selected := map[string]bool{"base": true, "left": true, "right": true, "top": true}
+	results := execute_plan(diamond_dag, selected, run_options{
+		executor: executor,
+		jobs:     1,
+		console:  io.Discard,
+		publish:  func(run_event) {},
+		ctx:      ctx,
+	})
+
+	for task := range selected {
+		result := results[task]
+		if result.status != status_cancelled || result.blocked_by != cancelled_by_interrupt {
+			t.Errorf("%s: got %s by %q, want %s by %q", task, result.status, result.blocked_by, status_cancelled, cancelled_by_interrupt)
+		}
+	}
+	if len(executor.started) != 0 {
+		t.Errorf("tasks started after the run was cancelled")
+	}
+}
@@ -0,0 +1,230 @@
+package main
+
+import (
+	_ "embed"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"regexp"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// dag_schema_json is the JSON Schema of dag.yaml, a copy of dag.schema.json at the root of the repository
+//
+//go:embed dag.schema.json
+var dag_schema_json []byte
+
+// json_schema is the subset of JSON Schema that dag.schema.json uses
+type json_schema struct {
+	Type                  schema_types            `json:"type"`
+	Properties            map[string]*json_schema `json:"properties"`
+	Additional_properties *json_schema            `json:"additionalProperties"`
+	Required              []string                `json:"required"`
+	Items                 *json_schema            `json:"items"`
+	Unique_items          bool                    `json:"uniqueItems"`
+	Min_length            int                     `json:"minLength"`
+	Min_properties        int                     `json:"minProperties"`
+	Max_properties        *int                    `json:"maxProperties"`
+	Enum                  []string                `json:"enum"`
+
+	never bool // the boolean schema false: nothing is valid
+}
+
+// schema_types is the "type" keyword, which holds either one type name or a list of them
+type schema_types []string
+
+func (types *schema_types) UnmarshalJSON(data []byte) error {
+	var single string
+	if err := json.Unmarshal(data, &single); err == nil {
+		*types = schema_types{single}
+		return nil
+	}
+	var list []string
+	if err := json.Unmarshal(data, &list); err != nil {
+		return err
+	}
+	*types = list
+	return nil
+}
+
+func (schema *json_schema) UnmarshalJSON(data []byte) error {
+	switch strings.TrimSpace(string(data)) {
+	case "true":
+		*schema = json_schema{}
+		return nil
+	case "false":
+		*schema = json_schema{never: true}
+		return nil
+	}
+	type plain json_schema
+	return json.Unmarshal(data, (*plain)(schema))
+}
+
+// dag_schema is dag_schema_json decoded once at startup
+var dag_schema = func() *json_schema {
+	var schema json_schema
+	if err := json.Unmarshal(dag_schema_json, &schema); err != nil {
+		panic(fmt.Sprintf("embedded dag.schema.json is invalid: %v", err))
+	}
+	return &schema
+}()
+
+// validate_dag_node checks the YAML tree of dag.yaml against the schema, returning one *ErrParse per violation
+func validate_dag_node(root *yaml.Node, location string) []error {
+	var violations []error
+	report := func(node *yaml.Node, path string, format string, args ...any) {
+		violations = append(violations, &ErrParse{
+			Location: location,
+			Line:     node.Line,
+			Column:   node.Column,
+			Path:     path,
+			Message:  fmt.Sprintf(format, args...),
+		})
+	}
+
+	var validate func(node *yaml.Node, schema *json_schema, path string)
+	validate = func(node *yaml.Node, schema *json_schema, path string) {
+		for node.Kind == yaml.AliasNode {
+			node = node.Alias
+		}
+		if schema.never {
+			report(node, path, "is not allowed")
+			return
+		}
+		kind := yaml_node_type(node)
+		if len(schema.Type) > 0 && !type_allowed(kind, schema.Type) {
+			report(node, path, "must be %s, found %s", strings.Join(schema.Type, " or "), kind)
+			return
+		}
+
+		switch kind {
+		case "string":
+			if len(node.Value) < schema.Min_length {
+				report(node, path, "must not be empty")
+			}
+			if len(schema.Enum) > 0 && !slices.Contains(schema.Enum, node.Value) {
+				report(node, path, "must be one of %s, found %q", strings.Join(schema.Enum, ", "), node.Value)
+			}
+		case "array":
+			seen := make(map[string]bool)
+			for i, item := range node.Content {
+				item_path := fmt.Sprintf("%s[%d]", path, i)
+				if schema.Unique_items && item.Kind == yaml.ScalarNode {
+					if seen[item.Value] {
+						report(item, item_path, "duplicates %q", item.Value)
+					}
+					seen[item.Value] = true
+				}
+				if schema.Items != nil {
+					validate(item, schema.Items, item_path)
+				}
+			}
+		case "object":
+			present := make(map[string]bool)
+			for i := 0; i+1 < len(node.Content); i += 2 {
+				key, value := node.Content[i], node.Content[i+1]
+				present[key.Value] = true
+				key_path := join_schema_path(path, key.Value)
+				if property, ok := schema.Properties[key.Value]; ok {
+					validate(value, property, key_path)
+				} else if schema.Additional_properties != nil {
+					if schema.Additional_properties.never {
+						report(key, key_path, "unknown key %q (expected one of %s)", key.Value, property_names(schema))
+						continue
+					}
+					validate(value, schema.Additional_properties, key_path)
+				}
+			}
+			if count := len(node.Content) / 2; count < schema.Min_properties {
+				report(node, path, "needs at least %d key(s), found %d", schema.Min_properties, count)
+			} else if schema.Max_properties != nil && count > *schema.Max_properties {
+				report(node, path, "allows at most %d key(s), found %d", *schema.Max_properties, count)
+			}
+			for _, name := range schema.Required {
+				if !present[name] {
+					report(node, path, "missing required key %q", name)
+				}
+			}
+		}
+	}
+
+	if root.Kind == 0 || (root.Kind == yaml.DocumentNode && len(root.Content) == 0) {
+		return []error{&ErrParse{Location: location, Message: "file is empty"}}
+	}
+	document := root
+	if document.Kind == yaml.DocumentNode {
+		document = document.Content[0]
+	}
+	validate(document, dag_schema, "")
+	return violations
+}
+
+// yaml_node_type returns the JSON Schema type name of a YAML node
+func yaml_node_type(node *yaml.Node) string {
+	switch node.Kind {
+	case yaml.MappingNode:
+		return "object"
+	case yaml.SequenceNode:
+		return "array"
+	}
+	switch node.ShortTag() {
+	case "!!null":
+		return "null"
+	case "!!bool":
+		return "boolean"
+	case "!!int":
+		return "integer"
+	case "!!float":
+		return "number"
+	}
+	return "string"
+}
+
+// type_allowed reports whether a node of type kind satisfies the "type" keyword
+func type_allowed(kind string, types schema_types) bool {
+	for _, allowed := range types {
+		if allowed == kind || (allowed == "number" && kind == "integer") {
+			return true
+		}
+	}
+	return false
+}
+
+// property_names lists the declared properties of schema for error messages
+func property_names(schema *json_schema) string {
+	names := make([]string, 0, len(schema.Properties))
+	for name := range schema.Properties {
+		names = append(names, strconv.Quote(name))
+	}
+	sort.Strings(names)
+	return strings.Join(names, ", ")
+}
+
+// schema_identifier_pattern matches keys that can appear unquoted in a path
+var schema_identifier_pattern = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_-]*$`)
+
+// join_schema_path appends a key to a path like dag."install go"[0], quoting keys that are not identifiers
+func join_schema_path(path string, key string) string {
+	if !schema_identifier_pattern.MatchString(key) {
+		key = strconv.Quote(key)
+	}
+	if path == "" {
+		return key
+	}
+	return path + "." + key
+}
+
+// run_schema prints the JSON Schema of dag.yaml
+func run_schema(args []string) {
+	flags := flag.NewFlagSet("schema", flag.ExitOnError)
+	add_logging_flags(flags)
+	flags.Parse(args)
+
+	os.Stdout.Write(dag_schema_json)
+}
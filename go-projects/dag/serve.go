@@ -0,0 +1,544 @@
+package main
+
+import (
+	"embed"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"io/fs"
+	"mime"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/PeterCullenBurbery/go_functions_002/v3/math_functions"
+)
+
+// web_assets holds the static web UI served at /
+//
+//go:embed web
+var web_assets embed.FS
+
+// task_info is the JSON view of a single task
+type task_info struct {
+	Name         string   `json:"name"`
+	Level        int      `json:"level"`
+	Dependencies []string `json:"dependencies"`
+	Tags         []string `json:"tags,omitempty"`
+	Run          string   `json:"run,omitempty"`
+}
+
+// graph_info is the JSON view of the whole DAG, printed by dag --json and served at /graph
+type graph_info struct {
+	Tasks []task_info `json:"tasks"`
+	Order []string    `json:"order"` // reverse topological execution order
+}
+
+// level_info is the JSON view of one level of the DAG
+type level_info struct {
+	Level int      `json:"level"`
+	Tasks []string `json:"tasks"`
+}
+
+// relation_info is the JSON view of the dependencies or dependents of a task
+type relation_info struct {
+	Task       string           `json:"task"`
+	Direct     []string         `json:"direct"`
+	Transitive []string         `json:"transitive"`
+	By_level   map[int][]string `json:"by_level,omitempty"`
+}
+
+// plan_info is the JSON view of the tasks a run would execute
+type plan_info struct {
+	Targets []string `json:"targets"`
+	Order   []string `json:"order"`
+}
+
+// run_record tracks a run started through the API
+type run_record struct {
+	Id          int                    `json:"id"`
+	Targets     []string               `json:"targets"`
+	Status      string                 `json:"status"` // "running" or "finished"
+	Started_at  string                 `json:"started_at"`
+	Finished_at string                 `json:"finished_at,omitempty"`
+	Results     map[string]result_info `json:"results,omitempty"`
+}
+
+// result_info is the JSON view of a task_result
+type result_info struct {
+	Status      string  `json:"status"`
+	Error       string  `json:"error,omitempty"`
+	Duration_ms float64 `json:"duration_ms"`
+	Blocked_by  string  `json:"blocked_by,omitempty"`
+	Allowed     bool    `json:"allowed_failure,omitempty"`
+}
+
+// dag_server serves a loaded DAG over HTTP
+type dag_server struct {
+	parsed  dag_file
+	levels  map[string]int
+	reverse map[string][]string
+	jobs    int
+	bus     *event_bus
+	metrics *run_metrics
+	hosts   map[string]bool // names the Host header may carry, see allowed_hosts
+
+	mutex sync.Mutex
+	runs  []*run_record
+}
+
+// run_serve starts the HTTP API
+func run_serve(args []string) {
+	flags := flag.NewFlagSet("serve", flag.ExitOnError)
+	add_logging_flags(flags)
+	address := flags.String("address", "127.0.0.1:8080", "address to listen on")
+	jobs := flags.Int("jobs", 1, "maximum number of tasks a run started through the API executes at the same time")
+	events_path := flags.String("events", "", "append events of API runs to this file as newline-delimited JSON")
+	allow_host := flags.String("allow-host", "",
+		"comma-separated host names requests may be addressed to besides localhost and the --address host")
+	add_source_flags(flags)
+	add_history_flags(flags)
+	add_metrics_flags(flags)
+	add_task_log_flags(flags)
+	flags.Parse(args)
+
+	require_fresh_source = true // POST /runs executes the graph
+	parsed, err := load_dag_file()
+	if err != nil {
+		fatal_error("dag_load_failed", err)
+	}
+	if err := check_dag(parsed.Dag); err != nil {
+		fatal_error("dag_invalid", err)
+	}
+
+	server := new_dag_server(parsed, *jobs, allowed_hosts(*address, strings.Split(*allow_host, ",")))
+	if *events_path != "" {
+		if _, err := start_ndjson_writer(*events_path, server.bus); err != nil {
+			fatal("events_open_failed", "error", err)
+		}
+	}
+	fmt.Printf("🌐 serving %d tasks on http://%s (web UI at /)\n", len(parsed.Dag), *address)
+	if err := http.ListenAndServe(*address, server.routes()); err != nil {
+		fatal("serve_failed", "error", err)
+	}
+}
+
+// new_dag_server prepares the graph views the handlers read from; hosts comes from allowed_hosts
+func new_dag_server(parsed dag_file, jobs int, hosts map[string]bool) *dag_server {
+	return &dag_server{
+		parsed:  parsed,
+		levels:  compute_levels(parsed.Dag),
+		reverse: build_reverse_graph(parsed.Dag),
+		jobs:    jobs,
+		bus:     new_event_bus(),
+		metrics: new_run_metrics(parsed.Tags),
+		hosts:   hosts,
+	}
+}
+
+// allowed_hosts returns the host names a request may be addressed to: the loopback names, the host of the
+// listen address unless it is a wildcard, and extra. Checking the Host header stops DNS rebinding, where a web
+// page on another site resolves its own name to 127.0.0.1 and then calls the API as a same-origin request.
+func allowed_hosts(address string, extra []string) map[string]bool {
+	hosts := map[string]bool{"localhost": true, "127.0.0.1": true, "::1": true}
+	if host, _, err := net.SplitHostPort(address); err == nil && host != "" {
+		if ip := net.ParseIP(host); ip == nil || !ip.IsUnspecified() {
+			hosts[strings.ToLower(host)] = true
+		}
+	}
+	for _, host := range extra {
+		if host = strings.TrimSpace(host); host != "" {
+			hosts[host_name(host)] = true
+		}
+	}
+	return hosts
+}
+
+// host_name returns the lower-case host of a Host header or address, without port or IPv6 brackets
+func host_name(host string) string {
+	if name, _, err := net.SplitHostPort(host); err == nil {
+		host = name
+	}
+	return strings.ToLower(strings.Trim(host, "[]"))
+}
+
+// check_host rejects requests whose Host header is not an allowed host name, on every route
+func (s *dag_server) check_host(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !s.hosts[host_name(r.Host)] {
+			write_error(w, http.StatusForbidden, fmt.Sprintf("requests to host %q are not allowed; see --allow-host", r.Host))
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// routes returns the handler for every endpoint, behind the Host check
+func (s *dag_server) routes() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /graph", s.handle_graph)
+	mux.HandleFunc("GET /why", s.handle_why)
+	mux.HandleFunc("GET /paths", s.handle_paths)
+	mux.HandleFunc("GET /tasks", s.handle_tasks)
+	mux.HandleFunc("GET /levels", s.handle_levels)
+	mux.HandleFunc("GET /tasks/{name}/deps", s.handle_deps)
+	mux.HandleFunc("GET /tasks/{name}/dependents", s.handle_dependents)
+	mux.HandleFunc("GET /plan", s.handle_plan)
+	mux.HandleFunc("GET /runs", s.handle_list_runs)
+	mux.HandleFunc("GET /runs/{id}", s.handle_get_run)
+	mux.HandleFunc("POST /runs", s.handle_start_run)
+	mux.HandleFunc("GET /events", s.handle_events)
+	mux.HandleFunc("GET /metrics", s.metrics.handle_metrics)
+
+	web, err := fs.Sub(web_assets, "web")
+	if err != nil {
+		fatal("web_assets_missing", "error", err)
+	}
+	mux.Handle("GET /", http.FileServerFS(web))
+	return s.check_host(mux)
+}
+
+// handle_graph returns every task and the execution order, as dag --json prints them
+func (s *dag_server) handle_graph(w http.ResponseWriter, r *http.Request) {
+	graph, err := describe_graph(s.parsed)
+	if err != nil {
+		write_error(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	write_json(w, http.StatusOK, graph)
+}
+
+// handle_why returns the paths from the from to the to query parameter, as dag why --json prints them.
+// shortest or longest (any value) select paths of one length; limit defaults to default_path_limit.
+func (s *dag_server) handle_why(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	s.serve_paths(w, r, query.Has("shortest"), query.Has("longest"))
+}
+
+// handle_paths returns the paths from the from to the to query parameter, as dag paths --json prints them
+func (s *dag_server) handle_paths(w http.ResponseWriter, r *http.Request) {
+	s.serve_paths(w, r, false, false)
+}
+
+// serve_paths validates the query parameters of /why and /paths and writes the path_info
+func (s *dag_server) serve_paths(w http.ResponseWriter, r *http.Request, shortest bool, longest bool) {
+	query := r.URL.Query()
+	from, to := query.Get("from"), query.Get("to")
+	if shortest && longest {
+		write_error(w, http.StatusBadRequest, "shortest and longest cannot be combined")
+		return
+	}
+	for _, task := range []string{from, to} {
+		if err := check_task_exists(task, s.parsed.Dag); err != nil {
+			write_error(w, http.StatusNotFound, err.Error())
+			return
+		}
+	}
+	limit := default_path_limit
+	if value := query.Get("limit"); value != "" {
+		parsed, err := strconv.Atoi(value)
+		if err != nil || parsed < 0 {
+			write_error(w, http.StatusBadRequest, fmt.Sprintf("invalid limit %q", value))
+			return
+		}
+		limit = parsed
+	}
+	length := path_length(from, to, s.parsed.Dag, shortest, longest)
+	write_json(w, http.StatusOK, describe_paths(from, to, s.parsed.Dag, length, limit))
+}
+
+// handle_tasks lists every task with its level and direct dependencies
+func (s *dag_server) handle_tasks(w http.ResponseWriter, r *http.Request) {
+	write_json(w, http.StatusOK, describe_tasks(s.parsed, s.levels))
+}
+
+// describe_tasks lists every task of parsed in name order
+func describe_tasks(parsed dag_file, levels map[string]int) []task_info {
+	tasks := make([]task_info, 0, len(parsed.Dag))
+	for _, name := range sorted_tasks(parsed.Dag) {
+		deps := append([]string{}, parsed.Dag[name]...)
+		sort.Strings(deps)
+		tasks = append(tasks, task_info{
+			Name:         name,
+			Level:        levels[name],
+			Dependencies: deps,
+			Tags:         parsed.Tags[name],
+			Run:          parsed.Run[name].script(),
+		})
+	}
+	return tasks
+}
+
+// describe_graph lists every task of parsed with the reverse topological execution order
+func describe_graph(parsed dag_file) (graph_info, error) {
+	order, err := math_functions.Reverse_topological_sort(parsed.Dag)
+	if err != nil {
+		return graph_info{}, err
+	}
+	return graph_info{Tasks: describe_tasks(parsed, compute_levels(parsed.Dag)), Order: order}, nil
+}
+
+// handle_levels groups the tasks by level, as dag_level_sorted prints them
+func (s *dag_server) handle_levels(w http.ResponseWriter, r *http.Request) {
+	grouped := make(map[int][]string)
+	for task, lvl := range s.levels {
+		grouped[lvl] = append(grouped[lvl], task)
+	}
+	levels := make([]level_info, 0, len(grouped))
+	for lvl, tasks := range grouped {
+		sort.Strings(tasks)
+		levels = append(levels, level_info{Level: lvl, Tasks: tasks})
+	}
+	sort.Slice(levels, func(i, j int) bool { return levels[i].Level < levels[j].Level })
+	write_json(w, http.StatusOK, levels)
+}
+
+// handle_deps returns the direct and transitive dependencies of a task
+func (s *dag_server) handle_deps(w http.ResponseWriter, r *http.Request) {
+	name := r.PathValue("name")
+	if _, ok := s.parsed.Dag[name]; !ok {
+		write_error(w, http.StatusNotFound, fmt.Sprintf("unknown task %q", name))
+		return
+	}
+	direct := append([]string{}, s.parsed.Dag[name]...)
+	sort.Strings(direct)
+	write_json(w, http.StatusOK, relation_info{
+		Task:       name,
+		Direct:     direct,
+		Transitive: non_nil(resolve_all_dependencies(name, s.parsed.Dag)),
+	})
+}
+
+// handle_dependents returns the direct and transitive dependents of a task, grouped by distance.
+// The distance query parameter selects shortest, longest (default) or all.
+func (s *dag_server) handle_dependents(w http.ResponseWriter, r *http.Request) {
+	name := r.PathValue("name")
+	if _, ok := s.parsed.Dag[name]; !ok {
+		write_error(w, http.StatusNotFound, fmt.Sprintf("unknown task %q", name))
+		return
+	}
+	mode := r.URL.Query().Get("distance")
+	switch mode {
+	case "":
+		mode = distance_longest
+	case distance_shortest, distance_longest, distance_all:
+	default:
+		write_error(w, http.StatusBadRequest, fmt.Sprintf("unknown distance mode %q", mode))
+		return
+	}
+	write_json(w, http.StatusOK, relation_info{
+		Task:       name,
+		Direct:     non_nil(s.reverse[name]),
+		Transitive: non_nil(resolve_all_dependencies(name, s.reverse)),
+		By_level:   dependents_by_distance(s.parsed.Dag, mode)[name],
+	})
+}
+
+// handle_plan returns the execution order for the target query parameters (every task if none)
+func (s *dag_server) handle_plan(w http.ResponseWriter, r *http.Request) {
+	targets := r.URL.Query()["target"]
+	order, err := s.plan(targets)
+	if err != nil {
+		write_error(w, http.StatusNotFound, err.Error())
+		return
+	}
+	write_json(w, http.StatusOK, plan_info{Targets: non_nil(targets), Order: order})
+}
+
+// plan returns the targets and their dependencies in reverse topological order
+func (s *dag_server) plan(targets []string) ([]string, error) {
+	selected, err := select_tasks(targets, s.parsed.Dag)
+	if err != nil {
+		return nil, err
+	}
+	return plan_order(selected, s.parsed.Dag)
+}
+
+// handle_list_runs lists the runs started through the API
+func (s *dag_server) handle_list_runs(w http.ResponseWriter, r *http.Request) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	runs := make([]run_record, 0, len(s.runs))
+	for _, run := range s.runs {
+		runs = append(runs, *run)
+	}
+	write_json(w, http.StatusOK, runs)
+}
+
+// handle_get_run returns a single run
+func (s *dag_server) handle_get_run(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(r.PathValue("id"))
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if err != nil || id < 1 || id > len(s.runs) {
+		write_error(w, http.StatusNotFound, fmt.Sprintf("unknown run %q", r.PathValue("id")))
+		return
+	}
+	write_json(w, http.StatusOK, *s.runs[id-1])
+}
+
+// handle_start_run starts a run of the targets in the JSON body ({"targets": [...]}; every task if empty).
+// A run executes commands on this machine, so the request must be JSON from the same origin: a web page on another
+// site can neither send that content type without a preflight nor forge the Origin header.
+func (s *dag_server) handle_start_run(w http.ResponseWriter, r *http.Request) {
+	if media_type, _, err := mime.ParseMediaType(r.Header.Get("Content-Type")); err != nil || media_type != "application/json" {
+		write_error(w, http.StatusUnsupportedMediaType, "POST /runs needs Content-Type: application/json")
+		return
+	}
+	if origin := r.Header.Get("Origin"); origin != "" && !same_origin(origin, r.Host) {
+		write_error(w, http.StatusForbidden, fmt.Sprintf("runs cannot be started from origin %q", origin))
+		return
+	}
+	var body struct {
+		Targets []string `json:"targets"`
+	}
+	if r.ContentLength != 0 {
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+			write_error(w, http.StatusBadRequest, fmt.Sprintf("invalid request body: %v", err))
+			return
+		}
+	}
+	if _, err := s.plan(body.Targets); err != nil {
+		write_error(w, http.StatusNotFound, err.Error())
+		return
+	}
+
+	s.mutex.Lock()
+	run := &run_record{
+		Id:         len(s.runs) + 1,
+		Targets:    non_nil(body.Targets),
+		Status:     "running",
+		Started_at: time.Now().Format(time.RFC3339),
+	}
+	s.runs = append(s.runs, run)
+	snapshot := *run
+	s.mutex.Unlock()
+
+	go func() {
+		selected, _ := select_tasks(body.Targets, s.parsed.Dag) // validated by s.plan above
+		history := new_history_recorder()
+		publish := func(event run_event) {
+			event.Run = run.Id
+			s.bus.publish(event)
+			history.record(event)
+			s.metrics.record(event)
+		}
+		results := execute_plan(s.parsed.Dag, selected, run_options{
+			commands: s.parsed.Run,
+			policies: s.parsed.Policy,
+			jobs:     s.jobs,
+			console:  os.Stdout,
+			publish:  publish,
+			logs_dir: task_logs_dir,
+		})
+
+		s.mutex.Lock()
+		defer s.mutex.Unlock()
+		run.Status = "finished"
+		run.Finished_at = time.Now().Format(time.RFC3339)
+		run.Results = make(map[string]result_info)
+		for task, result := range results {
+			run.Results[task] = to_result_info(result)
+		}
+	}()
+
+	write_json(w, http.StatusAccepted, snapshot)
+}
+
+// handle_events streams run events as Server-Sent Events until the client disconnects.
+// The run query parameter limits the stream to a single run.
+func (s *dag_server) handle_events(w http.ResponseWriter, r *http.Request) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		write_error(w, http.StatusInternalServerError, "streaming is not supported")
+		return
+	}
+	run_filter := 0
+	if value := r.URL.Query().Get("run"); value != "" {
+		id, err := strconv.Atoi(value)
+		if err != nil {
+			write_error(w, http.StatusBadRequest, fmt.Sprintf("invalid run %q", value))
+			return
+		}
+		run_filter = id
+	}
+
+	ch, unsubscribe := s.bus.subscribe(false)
+	defer unsubscribe()
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.WriteHeader(http.StatusOK)
+	flusher.Flush()
+
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case event := <-ch:
+			if run_filter != 0 && event.Run != run_filter {
+				continue
+			}
+			data, err := json.Marshal(event)
+			if err != nil {
+				continue
+			}
+			fmt.Fprintf(w, "event: %s\ndata: %s\n\n", event.Type, data)
+			flusher.Flush()
+		}
+	}
+}
+
+// same_origin reports whether the Origin header of a request names the host it was sent to
+func same_origin(origin string, host string) bool {
+	parsed, err := url.Parse(origin)
+	return err == nil && (parsed.Scheme == "http" || parsed.Scheme == "https") && strings.EqualFold(parsed.Host, host)
+}
+
+// to_result_info converts a task_result to its JSON view
+func to_result_info(result task_result) result_info {
+	info := result_info{
+		Status:      result.status,
+		Duration_ms: float64(result.duration.Microseconds()) / 1000,
+		Blocked_by:  result.blocked_by,
+		Allowed:     result.allowed,
+	}
+	if result.err != nil {
+		info.Error = result.err.Error()
+	}
+	return info
+}
+
+// write_json writes value as an indented JSON response
+func write_json(w http.ResponseWriter, status int, value any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	print_json(w, value)
+}
+
+// print_json writes value as indented JSON, the format of both the API and the --json flags
+func print_json(w io.Writer, value any) {
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	encoder.Encode(value)
+}
+
+// write_error writes a JSON error response
+func write_error(w http.ResponseWriter, status int, message string) {
+	write_json(w, status, map[string]string{"error": message})
+}
+
+// non_nil returns list, or an empty list so that JSON shows [] instead of null
+func non_nil(list []string) []string {
+	if list == nil {
+		return []string{}
+	}
+	return list
+}
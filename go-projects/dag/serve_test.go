@@ -0,0 +1,221 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// test_server serves the diamond fixture without run commands, so that runs succeed without executing anything
+func test_server(t *testing.T) *httptest.Server {
+	t.Helper()
+	server := httptest.NewServer(new_dag_server(dag_file{Dag: diamond_dag}, 2, allowed_hosts("127.0.0.1:0", nil)).routes())
+	t.Cleanup(server.Close)
+	return server
+}
+
+// get_body sends a GET request with the given Host header (the server's own if empty) and returns the response
+// status and body
+func get_body(t *testing.T, server *httptest.Server, path string, host string) (int, string) {
+	t.Helper()
+	request, err := http.NewRequest(http.MethodGet, server.URL+path, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if host != "" {
+		request.Host = host
+	}
+	response, err := http.DefaultClient.Do(request)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer response.Body.Close()
+	body, err := io.ReadAll(response.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return response.StatusCode, string(body)
+}
+
+// capture_stdout returns what run prints to standard output
+func capture_stdout(t *testing.T, run func()) string {
+	t.Helper()
+	reader, writer, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	saved := os.Stdout
+	os.Stdout = writer
+	output := make(chan string)
+	go func() {
+		content, _ := io.ReadAll(reader)
+		output <- string(content)
+	}()
+	run()
+	os.Stdout = saved
+	writer.Close()
+	return <-output
+}
+
+func Test_endpoints_match_cli_json(t *testing.T) {
+	use_test_integrity(t)
+	content := "dag:\n  base: []\n  left: [base]\n  right: [base]\n  top: [left, right, base]\ntags:\n  left: [ci]\n"
+	path := filepath.Join(t.TempDir(), "dag.yaml")
+	if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	use_test_source(t, path)
+	parsed, err := parse_dag_file([]byte(content), path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	server := httptest.NewServer(new_dag_server(parsed, 1, allowed_hosts("127.0.0.1:0", nil)).routes())
+	defer server.Close()
+
+	tests := []struct {
+		endpoint string
+		run      func()
+	}{
+		{"/graph", func() { run_order([]string{"--json", "--source", path}) }},
+		{"/why?from=top&to=base", func() { run_why([]string{"--json", "--source", path, "top", "base"}) }},
+		{"/why?from=top&to=base&longest", func() { run_why([]string{"--json", "--longest", "--source", path, "top", "base"}) }},
+		{"/why?from=base&to=top", func() { run_why([]string{"--json", "--source", path, "base", "top"}) }},
+		{"/paths?from=top&to=base&limit=2", func() { run_paths([]string{"--json", "--limit", "2", "--source", path, "top", "base"}) }},
+	}
+	for _, test := range tests {
+		status, body := get_body(t, server, test.endpoint, "")
+		if status != http.StatusOK {
+			t.Errorf("%s: got %d %s", test.endpoint, status, body)
+			continue
+		}
+		if cli := capture_stdout(t, test.run); body != cli {
+			t.Errorf("%s:\n%s\nCLI --json:\n%s", test.endpoint, body, cli)
+		}
+	}
+
+	status, body := get_body(t, server, "/paths?from=top&to=missing", "")
+	if status != http.StatusNotFound {
+		t.Errorf("unknown task: got %d %s, want 404", status, body)
+	}
+}
+
+func Test_rejects_foreign_host(t *testing.T) {
+	server := test_server(t)
+	port := server.URL[strings.LastIndex(server.URL, ":"):]
+	for _, endpoint := range []string{"/tasks", "/graph", "/why?from=top&to=base", "/metrics", "/"} {
+		for _, host := range []string{"evil.example" + port, "127.0.0.1.evil.example", "localhost.:1"} {
+			if status, body := get_body(t, server, endpoint, host); status != http.StatusForbidden {
+				t.Errorf("%s with Host %q: got %d %s, want 403", endpoint, host, status, body)
+			}
+		}
+		for _, host := range []string{"localhost" + port, "[::1]" + port, "LOCALHOST"} {
+			if status, body := get_body(t, server, endpoint, host); status != http.StatusOK {
+				t.Errorf("%s with Host %q: got %d %s, want 200", endpoint, host, status, body)
+			}
+		}
+	}
+
+	hosts := allowed_hosts("0.0.0.0:8080", []string{"dag.internal", ""})
+	if hosts["0.0.0.0"] || !hosts["dag.internal"] || len(hosts) != 4 {
+		t.Errorf("allowed_hosts: got %v", hosts)
+	}
+}
+
+// post_run sends POST /runs with the given headers and returns the response status and decoded body
+func post_run(t *testing.T, server *httptest.Server, headers map[string]string, body string) (int, map[string]any) {
+	t.Helper()
+	request, err := http.NewRequest(http.MethodPost, server.URL+"/runs", strings.NewReader(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for name, value := range headers {
+		request.Header.Set(name, value)
+	}
+	response, err := http.DefaultClient.Do(request)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer response.Body.Close()
+	var decoded map[string]any
+	if err := json.NewDecoder(response.Body).Decode(&decoded); err != nil {
+		t.Fatal(err)
+	}
+	return response.StatusCode, decoded
+}
+
+func Test_start_run_requires_json(t *testing.T) {
+	server := test_server(t)
+	for _, content_type := range []string{"", "text/plain", "application/x-www-form-urlencoded", "multipart/form-data; boundary=x"} {
+		status, body := post_run(t, server, map[string]string{"Content-Type": content_type}, `{"targets": ["top"]}`)
+		if status != http.StatusUnsupportedMediaType {
+			t.Errorf("Content-Type %q: got %d %v, want 415", content_type, status, body)
+		}
+	}
+}
+
+func Test_start_run_rejects_foreign_origin(t *testing.T) {
+	server := test_server(t)
+	for _, origin := range []string{"http://evil.example", "null", "file://", "http://" + strings.TrimPrefix(server.URL, "http://") + ".evil.example"} {
+		status, body := post_run(t, server, map[string]string{"Content-Type": "application/json", "Origin": origin}, `{}`)
+		if status != http.StatusForbidden {
+			t.Errorf("Origin %q: got %d %v, want 403", origin, status, body)
+		}
+	}
+}
+
+func Test_start_run(t *testing.T) {
+	server := test_server(t)
+	headers := map[string]string{"Content-Type": "application/json; charset=utf-8", "Origin": server.URL}
+	status, body := post_run(t, server, headers, `{"targets": ["left"]}`)
+	if status != http.StatusAccepted {
+		t.Fatalf("got %d %v, want 202", status, body)
+	}
+
+	status, body = post_run(t, server, headers, `{"targets": ["missing"]}`)
+	if status != http.StatusNotFound {
+		t.Errorf("unknown target: got %d %v, want 404", status, body)
+	}
+
+	// Without run commands every task succeeds at once
+	run := wait_for_run(t, server, 1)
+	for _, task := range []string{"base", "left"} {
+		if run.Results[task].Status != status_succeeded {
+			t.Errorf("%s: got %q, want %q", task, run.Results[task].Status, status_succeeded)
+		}
+	}
+	if _, ok := run.Results["top"]; ok {
+		t.Errorf("top ran but is not a dependency of left")
+	}
+}
+
+// wait_for_run polls GET /runs/{id} until the run has finished and returns it
+func wait_for_run(t *testing.T, server *httptest.Server, id int) run_record {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		response, err := http.Get(fmt.Sprintf("%s/runs/%d", server.URL, id))
+		if err != nil {
+			t.Fatal(err)
+		}
+		var run run_record
+		err = json.NewDecoder(response.Body).Decode(&run)
+		response.Body.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if run.Status == "finished" {
+			return run
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("run %d did not finish: %+v", id, run)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
@@ -0,0 +1,359 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// update_golden rewrites the golden files in testdata instead of comparing against them
+var update_golden = flag.Bool("update", false, "rewrite the golden files in testdata")
+
+// recorded_call is one Execute call seen by recording_executor
+type recorded_call struct {
+	Sequence    int               `json:"sequence"` // 1 for the first task started
+	Task        string            `json:"task"`
+	Kind        string            `json:"kind,omitempty"`
+	Command     string            `json:"command,omitempty"`
+	Started_ms  float64           `json:"started_ms"` // since the first call
+	Finished_ms float64           `json:"finished_ms"`
+	Error       string            `json:"error,omitempty"`
+	Environment map[string]string `json:"environment"`
+}
+
+// recording_executor is an Executor that runs nothing. It passes every call through backend_executor and records
+// the order and timing of the calls and the environment the runner receives; it fails or hangs the tasks it is
+// scripted to.
+type recording_executor struct {
+	fail     map[string]bool
+	hang     map[string]bool
+	duration time.Duration
+	hang_for time.Duration
+
+	mutex sync.Mutex
+	start time.Time
+	calls []*recorded_call
+}
+
+// runner_func adapts a function to command_runner
+type runner_func func(ctx context.Context, argv []string, env []string, output io.Writer) error
+
+func (run runner_func) run(ctx context.Context, argv []string, env []string, output io.Writer) error {
+	return run(ctx, argv, env, output)
+}
+
+func (executor *recording_executor) Execute(ctx context.Context, task string, command task_command, output io.Writer) error {
+	executor.mutex.Lock()
+	if executor.start.IsZero() {
+		executor.start = time.Now()
+	}
+	call := &recorded_call{
+		Sequence:   len(executor.calls) + 1,
+		Task:       task,
+		Kind:       command.Kind,
+		Command:    command.Argument,
+		Started_ms: executor.since_start(),
+	}
+	executor.calls = append(executor.calls, call)
+	executor.mutex.Unlock()
+
+	// backend_executor succeeds at once for a task without a command, and dag.yaml has none
+	if command.Argument == "" {
+		command = task_command{Kind: kind_shell, Argument: "exit 0"}
+	}
+	backend := &backend_executor{goos: "windows", runner: runner_func(func(ctx context.Context, argv []string, env []string, output io.Writer) error {
+		// Only what the executor adds; the inherited environment differs between machines
+		environment := make(map[string]string)
+		for _, entry := range env {
+			name, value, _ := strings.Cut(entry, "=")
+			environment[name] = value
+		}
+		executor.mutex.Lock()
+		call.Environment = environment
+		executor.mutex.Unlock()
+		return executor.simulate(ctx, task, output)
+	})}
+	err := backend.Execute(ctx, task, command, output)
+
+	executor.mutex.Lock()
+	call.Finished_ms = executor.since_start()
+	if err != nil {
+		call.Error = err.Error()
+	}
+	executor.mutex.Unlock()
+	return err
+}
+
+// simulate fails, hangs or sleeps as task is scripted to
+func (executor *recording_executor) simulate(ctx context.Context, task string, output io.Writer) error {
+	// sleep waits for d unless the run is cancelled first
+	sleep := func(d time.Duration) error {
+		select {
+		case <-time.After(d):
+			return nil
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+	var err error
+	switch {
+	case executor.fail[task]:
+		err = fmt.Errorf("simulated failure")
+	case executor.hang[task]:
+		if err = sleep(executor.hang_for); err == nil {
+			err = fmt.Errorf("simulated hang of %s", executor.hang_for)
+		}
+	default:
+		err = sleep(executor.duration)
+	}
+	fmt.Fprintf(output, "simulated %s\n", task)
+	return err
+}
+
+// since_start returns the milliseconds since the first call; the caller holds the mutex
+func (executor *recording_executor) since_start() float64 {
+	return float64(time.Since(executor.start).Microseconds()) / 1000
+}
+
+// check_simulation compares a simulated run with the DAG and returns every violation of the scheduling rules:
+// a task starts only after its dependencies succeeded or were allowed to fail, skips and cancellations come from
+// scripted failures, and no more than jobs tasks run at the same time
+func check_simulation(dag map[string][]string, selected map[string]bool, jobs int, executor *recording_executor, results map[string]task_result) []string {
+	var violations []string
+	calls := make(map[string]*recorded_call)
+	for _, call := range executor.calls {
+		if calls[call.Task] != nil {
+			violations = append(violations, fmt.Sprintf("%s ran more than once", call.Task))
+		}
+		calls[call.Task] = call
+	}
+
+	for _, task := range sorted_tasks(dag) {
+		if !selected[task] {
+			if calls[task] != nil {
+				violations = append(violations, fmt.Sprintf("%s ran but was not selected", task))
+			}
+			continue
+		}
+		result, ok := results[task]
+		if !ok {
+			violations = append(violations, fmt.Sprintf("%s has no result", task))
+			continue
+		}
+		call := calls[task]
+		scripted := executor.fail[task] || executor.hang[task]
+
+		switch result.status {
+		case status_skipped:
+			if call != nil {
+				violations = append(violations, fmt.Sprintf("%s was skipped but ran", task))
+			}
+			if blocker := results[result.blocked_by]; blocker.status != status_failed || blocker.allowed {
+				violations = append(violations, fmt.Sprintf("%s is blocked by %q, which did not fail", task, result.blocked_by))
+			}
+		case status_cancelled:
+			if blocker := results[result.blocked_by]; blocker.status != status_failed {
+				violations = append(violations, fmt.Sprintf("%s is cancelled by %q, which did not fail", task, result.blocked_by))
+			}
+		case status_succeeded, status_failed:
+			if call == nil {
+				violations = append(violations, fmt.Sprintf("%s %s without running", task, result.status))
+				continue
+			}
+			// Written out rather than taken from task_environment, which is what this checks
+			if want := map[string]string{"DAG_TASK": task}; !reflect.DeepEqual(call.Environment, want) {
+				violations = append(violations, fmt.Sprintf("%s got the environment %v, want %v", task, call.Environment, want))
+			}
+			if scripted != (result.status == status_failed) {
+				violations = append(violations, fmt.Sprintf("%s %s, but was scripted to fail: %t", task, result.status, scripted))
+			}
+			for _, dep := range dag[task] {
+				if !selected[dep] {
+					continue
+				}
+				if dep_result := results[dep]; dep_result.status != status_succeeded && !dep_result.allowed {
+					violations = append(violations, fmt.Sprintf("%s ran although its dependency %s %s", task, dep, results[dep].status))
+				} else if dep_call := calls[dep]; dep_call == nil || dep_call.Finished_ms > call.Started_ms {
+					violations = append(violations, fmt.Sprintf("%s started before its dependency %s finished", task, dep))
+				}
+			}
+		}
+	}
+
+	if running := max_concurrency(executor.calls); running > jobs {
+		violations = append(violations, fmt.Sprintf("%d tasks ran at the same time with --jobs %d", running, jobs))
+	}
+	return violations
+}
+
+// max_concurrency returns the largest number of calls that overlapped in time
+func max_concurrency(calls []*recorded_call) int {
+	type edge struct {
+		at    float64
+		delta int
+	}
+	var edges []edge
+	for _, call := range calls {
+		edges = append(edges, edge{call.Started_ms, 1}, edge{call.Finished_ms, -1})
+	}
+	// A task that finishes at the same instant another starts does not overlap it
+	sort.Slice(edges, func(i, j int) bool {
+		if edges[i].at != edges[j].at {
+			return edges[i].at < edges[j].at
+		}
+		return edges[i].delta < edges[j].delta
+	})
+	running, highest := 0, 0
+	for _, e := range edges {
+		running += e.delta
+		highest = max(highest, running)
+	}
+	return highest
+}
+
+// simulation_golden is the part of a simulated run that does not depend on timing
+type simulation_golden struct {
+	Calls   []golden_call            `json:"calls"` // in start order with one job, by task otherwise
+	Results map[string]golden_result `json:"results"`
+}
+
+type golden_call struct {
+	Task        string            `json:"task"`
+	Error       string            `json:"error,omitempty"`
+	Environment map[string]string `json:"environment"`
+}
+
+type golden_result struct {
+	Status     string `json:"status"`
+	Blocked_by string `json:"blocked_by,omitempty"`
+	Allowed    bool   `json:"allowed_failure,omitempty"`
+}
+
+// Test_simulated_runs runs the real dag.yaml through recording_executor and compares the calls and results
+// with testdata/simulate/<scenario>.json; go test -run Test_simulated_runs -update rewrites them
+func Test_simulated_runs(t *testing.T) {
+	content, err := os.ReadFile("dag.yaml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	parsed, err := parse_dag_file(content, "dag.yaml")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	scenarios := []struct {
+		name     string
+		targets  []string
+		jobs     int
+		policy   string
+		policies map[string]string
+		fail     []string
+		hang     []string // until the run is cancelled
+		saturate bool     // the run must reach jobs tasks at the same time
+	}{
+		{name: "all_tasks_one_job", jobs: 1},
+		{name: "all_tasks_four_jobs", jobs: 4, saturate: true},
+		{name: "targets", targets: []string{"install redhat.java", "configure settings for vs code"}, jobs: 2},
+		{name: "failure_skips_dependents", jobs: 4, fail: []string{"install choco"}},
+		{name: "allow_failure", jobs: 4, fail: []string{"install choco"},
+			policies: map[string]string{"install choco": policy_allow_failure}},
+		// The four tasks started first: the failure cancels the three hanging ones and everything not yet started
+		{name: "fail_fast", jobs: 4, policy: policy_fail_fast, fail: []string{"hide search box"},
+			hang: []string{"install 7 zip", "install WinSCP", "install choco"}},
+	}
+
+	for _, scenario := range scenarios {
+		t.Run(scenario.name, func(t *testing.T) {
+			selected, err := select_tasks(scenario.targets, parsed.Dag)
+			if err != nil {
+				t.Fatal(err)
+			}
+			executor := &recording_executor{
+				fail:     make(map[string]bool),
+				hang:     make(map[string]bool),
+				duration: 2 * time.Millisecond,
+				hang_for: time.Minute,
+			}
+			for _, task := range scenario.fail {
+				executor.fail[task] = true
+			}
+			for _, task := range scenario.hang {
+				executor.hang[task] = true
+			}
+			results := execute_plan(parsed.Dag, selected, run_options{
+				commands: parsed.Run,
+				executor: executor,
+				jobs:     scenario.jobs,
+				console:  io.Discard,
+				publish:  func(run_event) {},
+				policy:   scenario.policy,
+				policies: scenario.policies,
+			})
+
+			for _, violation := range check_simulation(parsed.Dag, selected, scenario.jobs, executor, results) {
+				t.Error(violation)
+			}
+			if running := max_concurrency(executor.calls); scenario.saturate && running != scenario.jobs {
+				t.Errorf("at most %d tasks ran at the same time, want %d", running, scenario.jobs)
+			}
+			compare_golden(t, filepath.Join("testdata", "simulate", scenario.name+".json"),
+				simulation_result(executor, results, scenario.jobs))
+		})
+	}
+}
+
+// simulation_result keeps the calls and results of a simulated run that must be the same on every machine
+func simulation_result(executor *recording_executor, results map[string]task_result, jobs int) simulation_golden {
+	golden := simulation_golden{Results: make(map[string]golden_result)}
+	for _, call := range executor.calls {
+		golden.Calls = append(golden.Calls, golden_call{Task: call.Task, Error: call.Error, Environment: call.Environment})
+	}
+	if jobs > 1 {
+		sort.Slice(golden.Calls, func(i, j int) bool { return golden.Calls[i].Task < golden.Calls[j].Task })
+	}
+	for task, result := range results {
+		golden.Results[task] = golden_result{Status: result.status, Blocked_by: result.blocked_by, Allowed: result.allowed}
+	}
+	return golden
+}
+
+// compare_golden fails the test when value, as indented JSON, differs from the file at path
+func compare_golden(t *testing.T, path string, value any) {
+	t.Helper()
+	content, err := json.MarshalIndent(value, "", "  ")
+	if err != nil {
+		t.Fatal(err)
+	}
+	compare_golden_file(t, path, string(content)+"\n")
+}
+
+// compare_golden_file fails the test when content differs from the file at path; -update rewrites the file
+func compare_golden_file(t *testing.T, path string, content string) {
+	t.Helper()
+	if *update_golden {
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		return
+	}
+	want, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("%v (run go test -update to create it)", err)
+	}
+	if string(want) != content {
+		t.Errorf("%s differs (run go test -update after checking the change):\n%s", path, content)
+	}
+}
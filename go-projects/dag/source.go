@@ -0,0 +1,305 @@
+package main
+
+import (
+	"crypto/sha256"
+	_ "embed"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/PeterCullenBurbery/go_functions_002/v3/system_management_functions"
+	"gopkg.in/yaml.v3"
+)
+
+const dag_blob_url = "https://github.com/PeterCullenBurbery/dag/blob/main/dag.yaml"
+
+// embedded_dag is the copy of dag.yaml bundled at build time,
+// used for the default source with --offline when there is no cached copy
+//
+//go:embed dag.yaml
+var embedded_dag []byte
+
+// source is the location of dag.yaml: a GitHub blob URL, a raw URL or a local path
+var source string
+
+// offline skips the download and reads the cached copy (or the embedded one)
+var offline bool
+
+// require_fresh_source makes a failed download an error instead of a fallback to the cached copy.
+// Commands that execute tasks set it, so they never run a stale graph without --offline.
+var require_fresh_source bool
+
+// cache_metadata records the validators GitHub sent with the cached copy
+type cache_metadata struct {
+	Url           string `json:"url"`
+	Etag          string `json:"etag,omitempty"`
+	Last_modified string `json:"last_modified,omitempty"`
+	Fetched_at    string `json:"fetched_at"`
+}
+
+// add_source_flags registers the flags that control where dag.yaml comes from
+func add_source_flags(flags *flag.FlagSet) {
+	flags.StringVar(&source, "source", dag_blob_url, "URL or local path of dag.yaml")
+	flags.BoolVar(&offline, "offline", false, "use the cached dag.yaml (or the embedded copy of the default source) without downloading")
+	add_integrity_flags(flags)
+}
+
+// load_dag returns the task -> dependencies map of dag.yaml
+func load_dag() (map[string][]string, error) {
+	parsed, err := load_dag_file()
+	return parsed.Dag, err
+}
+
+// source_digest identifies the exact bytes a DAG was read from
+type source_digest struct {
+	Location string `yaml:"location"`
+	Sha256   string `yaml:"sha256"`
+}
+
+// load_dag_file fetches dag.yaml and returns the parsed file
+func load_dag_file() (dag_file, error) {
+	parsed, _, err := load_dag_source()
+	return parsed, err
+}
+
+// load_dag_source fetches dag.yaml and returns the parsed file with the digest of the bytes it was parsed from
+func load_dag_source() (dag_file, source_digest, error) {
+	// Step 1: Read a local file, or fetch a URL through the cache
+	var file_content []byte
+	location := source
+	if strings.HasPrefix(source, "http://") || strings.HasPrefix(source, "https://") {
+		if strings.Contains(source, "/blob/") {
+			raw_url, err := system_management_functions.Convert_blob_to_raw_github_url(source)
+			if err != nil {
+				return dag_file{}, source_digest{}, fmt.Errorf("convert %s to a raw URL: %w", source, err)
+			}
+			location = raw_url
+		}
+		content, err := fetch_dag_source(location)
+		if err != nil {
+			return dag_file{}, source_digest{}, err
+		}
+		file_content = content
+	} else {
+		content, err := os.ReadFile(source)
+		if err != nil {
+			return dag_file{}, source_digest{}, err
+		}
+		file_content = content
+	}
+
+	// Step 2: Verify the pinned digest and signature
+	if err := verify_integrity(file_content, location); err != nil {
+		return dag_file{}, source_digest{}, err
+	}
+
+	// Step 3: Parse YAML
+	parsed, err := parse_dag_file(file_content, location)
+	if err != nil {
+		return dag_file{}, source_digest{}, err
+	}
+
+	sum := sha256.Sum256(file_content)
+	return parsed, source_digest{Location: location, Sha256: hex.EncodeToString(sum[:])}, nil
+}
+
+// parse_dag_file decodes dag.yaml, reporting syntax errors and schema violations as *ErrParse
+func parse_dag_file(content []byte, location string) (dag_file, error) {
+	var root yaml.Node
+	if err := yaml.Unmarshal(content, &root); err != nil {
+		return dag_file{}, new_parse_error(location, err, nil)
+	}
+	if violations := validate_dag_node(&root, location); len(violations) > 0 {
+		return dag_file{}, errors.Join(violations...)
+	}
+	var parsed dag_file
+	if err := root.Decode(&parsed); err != nil {
+		return dag_file{}, new_parse_error(location, err, &root)
+	}
+	return parsed, nil
+}
+
+// yaml_line_pattern matches the "line N: " prefix yaml.v3 puts in front of its messages
+var yaml_line_pattern = regexp.MustCompile(`^(?:yaml: )?line (\d+): `)
+
+// new_parse_error extracts the position from a yaml.v3 error; the column is looked up in root when available
+func new_parse_error(location string, err error, root *yaml.Node) *ErrParse {
+	message := err.Error()
+	var type_error *yaml.TypeError
+	if errors.As(err, &type_error) && len(type_error.Errors) > 0 {
+		message = type_error.Errors[0]
+	}
+
+	parse_error := &ErrParse{Location: location, Message: strings.TrimPrefix(message, "yaml: "), Err: err}
+	if match := yaml_line_pattern.FindStringSubmatch(message); match != nil {
+		parse_error.Line, _ = strconv.Atoi(match[1])
+		parse_error.Message = message[len(match[0]):]
+		parse_error.Column = first_column_on_line(root, parse_error.Line)
+	}
+	return parse_error
+}
+
+// first_column_on_line returns the column of the first node of the tree that starts on line, or 0
+func first_column_on_line(node *yaml.Node, line int) int {
+	if node == nil {
+		return 0
+	}
+	if node.Line == line && node.Kind != yaml.DocumentNode {
+		return node.Column
+	}
+	for _, child := range node.Content {
+		if column := first_column_on_line(child, line); column != 0 {
+			return column
+		}
+	}
+	return 0
+}
+
+// fetch_dag_source returns the contents of url, revalidating the cached copy with ETag/Last-Modified.
+// When the download fails it falls back to the cached copy unless require_fresh_source is set.
+// Only --offline uses the embedded copy, and only for the default source.
+func fetch_dag_source(url string) ([]byte, error) {
+	data_path, meta_path, err := cache_paths(url)
+	if err != nil {
+		slog.Warn("cache_unavailable", "error", err)
+	}
+
+	cached, cached_err := os.ReadFile(data_path)
+	var meta cache_metadata
+	if cached_err == nil {
+		if raw, err := os.ReadFile(meta_path); err == nil {
+			json.Unmarshal(raw, &meta)
+		}
+	}
+
+	if offline {
+		if cached_err == nil {
+			return cached, nil
+		}
+		if source != dag_blob_url {
+			return nil, fmt.Errorf("no cached copy of %s", url)
+		}
+		slog.Warn("no_cached_copy", "url", url, "fallback", "embedded dag.yaml")
+		return embedded_dag, nil
+	}
+
+	content, new_meta, not_modified, err := download_with_validators(url, meta, cached_err == nil)
+	if err != nil {
+		if cached_err == nil && !require_fresh_source {
+			slog.Warn("download_failed", "error", err, "fallback", "cached copy", "fetched_at", meta.Fetched_at)
+			return cached, nil
+		}
+		return nil, err
+	}
+	if not_modified {
+		slog.Debug("cache_revalidated", "url", url, "path", data_path)
+		return cached, nil
+	}
+	slog.Debug("source_downloaded", "url", url, "bytes", len(content))
+
+	if data_path != "" {
+		if err := write_cache(data_path, meta_path, content, new_meta); err != nil {
+			slog.Warn("cache_write_failed", "error", err)
+		}
+	}
+	return content, nil
+}
+
+// download_with_validators performs a conditional GET of url.
+// not_modified is true when the server answered 304 for the cached copy.
+func download_with_validators(url string, meta cache_metadata, have_cached bool) (content []byte, new_meta cache_metadata, not_modified bool, err error) {
+	request, err := http.NewRequest(http.MethodGet, url, nil)
+	if err != nil {
+		return nil, meta, false, err
+	}
+	if have_cached {
+		if meta.Etag != "" {
+			request.Header.Set("If-None-Match", meta.Etag)
+		}
+		if meta.Last_modified != "" {
+			request.Header.Set("If-Modified-Since", meta.Last_modified)
+		}
+	}
+
+	client := &http.Client{Timeout: 30 * time.Second}
+	response, err := client.Do(request)
+	if err != nil {
+		return nil, meta, false, &ErrDownload{Url: url, Err: err}
+	}
+	defer response.Body.Close()
+
+	if response.StatusCode == http.StatusNotModified && have_cached {
+		return nil, meta, true, nil
+	}
+	if response.StatusCode != http.StatusOK {
+		return nil, meta, false, &ErrDownload{Url: url, Status_code: response.StatusCode, Err: errors.New(response.Status)}
+	}
+
+	content, err = io.ReadAll(response.Body)
+	if err != nil {
+		return nil, meta, false, &ErrDownload{Url: url, Status_code: response.StatusCode, Err: err}
+	}
+	new_meta = cache_metadata{
+		Url:           url,
+		Etag:          response.Header.Get("ETag"),
+		Last_modified: response.Header.Get("Last-Modified"),
+		Fetched_at:    time.Now().Format(time.RFC3339),
+	}
+	return content, new_meta, false, nil
+}
+
+// cache_paths returns the data and metadata file locations for url inside the user cache directory
+func cache_paths(url string) (string, string, error) {
+	cache_root, err := os.UserCacheDir()
+	if err != nil {
+		return "", "", err
+	}
+	sum := sha256.Sum256([]byte(url))
+	key := hex.EncodeToString(sum[:])[:16]
+	dir := filepath.Join(cache_root, "dag")
+	return filepath.Join(dir, key+".yaml"), filepath.Join(dir, key+".json"), nil
+}
+
+// write_cache stores content and its metadata, replacing files atomically so concurrent runs never see partial copies
+func write_cache(data_path string, meta_path string, content []byte, meta cache_metadata) error {
+	if err := os.MkdirAll(filepath.Dir(data_path), 0o755); err != nil {
+		return err
+	}
+	meta_json, err := json.MarshalIndent(meta, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := write_file_atomic(data_path, content); err != nil {
+		return err
+	}
+	return write_file_atomic(meta_path, meta_json)
+}
+
+// write_file_atomic writes content to a temporary file next to path and renames it into place
+func write_file_atomic(path string, content []byte) error {
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".*.tmp")
+	if err != nil {
+		return err
+	}
+	if _, err := tmp.Write(content); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
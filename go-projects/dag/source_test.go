@@ -0,0 +1,164 @@
+package main
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+)
+
+const test_dag_yaml = "dag:\n  a: []\n  b: [a]\n"
+
+// use_test_source points the user cache directory at a fresh temporary directory and resets the source flags
+func use_test_source(t *testing.T, url string) {
+	t.Helper()
+	dir := t.TempDir()
+	t.Setenv("XDG_CACHE_HOME", dir)
+	t.Setenv("LocalAppData", dir)
+	t.Setenv("HOME", dir)
+	saved_source, saved_offline, saved_fresh := source, offline, require_fresh_source
+	t.Cleanup(func() {
+		source, offline, require_fresh_source = saved_source, saved_offline, saved_fresh
+	})
+	source, offline, require_fresh_source = url, false, false
+}
+
+// validator_server serves test_dag_yaml with the given validator header and answers 304 to a matching request.
+// failing makes every request fail with 500; requests counts the requests served.
+func validator_server(t *testing.T, header string, value string, failing *atomic.Bool, requests *atomic.Int32) *httptest.Server {
+	t.Helper()
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+		if failing.Load() {
+			http.Error(w, "unavailable", http.StatusInternalServerError)
+			return
+		}
+		conditional := map[string]string{"ETag": "If-None-Match", "Last-Modified": "If-Modified-Since"}[header]
+		if r.Header.Get(conditional) == value {
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		w.Header().Set(header, value)
+		w.Write([]byte(test_dag_yaml))
+	}))
+	t.Cleanup(server.Close)
+	return server
+}
+
+func Test_fetch_dag_source_revalidates(t *testing.T) {
+	validators := map[string]string{
+		"ETag":          `"v1"`,
+		"Last-Modified": "Mon, 19 Oct 2026 07:00:00 GMT",
+	}
+	for header, value := range validators {
+		t.Run(header, func(t *testing.T) {
+			var failing atomic.Bool
+			var requests atomic.Int32
+			server := validator_server(t, header, value, &failing, &requests)
+			use_test_source(t, server.URL)
+
+			first, err := fetch_dag_source(server.URL)
+			if err != nil || string(first) != test_dag_yaml {
+				t.Fatalf("first fetch = %q, %v", first, err)
+			}
+			data_path, _, _ := cache_paths(server.URL)
+			cached, err := os.ReadFile(data_path)
+			if err != nil || string(cached) != test_dag_yaml {
+				t.Fatalf("cached copy = %q, %v", cached, err)
+			}
+
+			// The second fetch sends the validator back and is answered 304 from the cache
+			os.WriteFile(data_path, []byte(test_dag_yaml+"  c: []\n"), 0o644)
+			second, err := fetch_dag_source(server.URL)
+			if err != nil || string(second) != test_dag_yaml+"  c: []\n" {
+				t.Fatalf("revalidated fetch = %q, %v; want the cached copy", second, err)
+			}
+			if requests.Load() != 2 {
+				t.Errorf("server saw %d requests, want 2", requests.Load())
+			}
+		})
+	}
+}
+
+func Test_fetch_dag_source_offline(t *testing.T) {
+	var failing atomic.Bool
+	var requests atomic.Int32
+	server := validator_server(t, "ETag", `"v1"`, &failing, &requests)
+	use_test_source(t, server.URL)
+
+	// Without a cached copy, --offline refuses anything but the default source
+	offline = true
+	if _, err := fetch_dag_source(server.URL); err == nil {
+		t.Error("offline fetch without a cached copy succeeded")
+	}
+
+	// With a cached copy, --offline reads it without a request
+	offline = false
+	if _, err := fetch_dag_source(server.URL); err != nil {
+		t.Fatal(err)
+	}
+	offline = true
+	content, err := fetch_dag_source(server.URL)
+	if err != nil || string(content) != test_dag_yaml {
+		t.Errorf("offline fetch = %q, %v", content, err)
+	}
+	if requests.Load() != 1 {
+		t.Errorf("server saw %d requests, want 1", requests.Load())
+	}
+
+	// The default source falls back to the embedded copy, but only with --offline
+	source = dag_blob_url
+	content, err = fetch_dag_source("https://example.invalid/never-cached/dag.yaml")
+	if err != nil || !bytes.Equal(content, embedded_dag) {
+		t.Errorf("offline fetch of the default source = %d bytes, %v; want the embedded copy", len(content), err)
+	}
+	offline = false
+	failing.Store(true)
+	if _, err := fetch_dag_source(server.URL + "/never-cached"); err == nil {
+		t.Error("online fetch fell back to the embedded copy")
+	}
+}
+
+func Test_fetch_dag_source_fallback(t *testing.T) {
+	var failing atomic.Bool
+	var requests atomic.Int32
+	server := validator_server(t, "ETag", `"v1"`, &failing, &requests)
+	use_test_source(t, server.URL)
+
+	if _, err := fetch_dag_source(server.URL); err != nil {
+		t.Fatal(err)
+	}
+	failing.Store(true)
+
+	// A failed download falls back to the cached copy
+	content, err := fetch_dag_source(server.URL)
+	if err != nil || string(content) != test_dag_yaml {
+		t.Errorf("fetch with the server down = %q, %v; want the cached copy", content, err)
+	}
+
+	// Commands that execute tasks refuse the stale copy
+	require_fresh_source = true
+	if _, err := fetch_dag_source(server.URL); err == nil {
+		t.Error("fetch with require_fresh_source fell back to the cached copy")
+	}
+}
+
+// The copies embedded in the binary must match the files at the root of the repository
+func Test_embedded_copies_match_root(t *testing.T) {
+	for _, name := range []string{"dag.yaml", "dag.schema.json"} {
+		root, err := os.ReadFile(filepath.Join("..", "..", name))
+		if err != nil {
+			t.Skipf("repository root not available: %v", err)
+		}
+		local, err := os.ReadFile(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(root, local) {
+			t.Errorf("go-projects/dag/%s differs from %s at the repository root; copy the root file over", name, name)
+		}
+	}
+}
@@ -0,0 +1,141 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// task_logs_dir holds one directory per task with a log file per execution; empty disables capturing
+var task_logs_dir string
+
+// task_log_time_format starts the name of log files so that lexical order is chronological order
+const task_log_time_format = "20060102T150405.000Z"
+
+// add_task_log_flags registers the flag that locates the per-task log files
+func add_task_log_flags(flags *flag.FlagSet) {
+	flags.StringVar(&task_logs_dir, "logs", default_task_logs_dir(), "directory for per-task log files (empty to disable)")
+}
+
+// default_task_logs_dir returns logs inside the user cache directory, next to the run history
+func default_task_logs_dir() string {
+	cache_root, err := os.UserCacheDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(cache_root, "dag", "logs")
+}
+
+// task_log_name turns a task name into a directory name that is valid on every platform. Names that had to change
+// get a short hash of the task name, so that "install vs code" and "install vs_code" keep separate logs.
+func task_log_name(task string) string {
+	changed := task == "" || strings.HasPrefix(task, ".") || strings.HasSuffix(task, ".")
+	name := strings.Map(func(r rune) rune {
+		switch {
+		case r >= 'a' && r <= 'z', r >= '0' && r <= '9', r == '-', r == '.':
+			return r
+		case r >= 'A' && r <= 'Z':
+			changed = true // case-insensitive file systems would merge Build and build
+			return r
+		}
+		changed = true
+		return '_'
+	}, task)
+	if !changed {
+		return name
+	}
+	sum := sha256.Sum256([]byte(task))
+	return name + "-" + hex.EncodeToString(sum[:4])
+}
+
+// open_task_log creates the log file of one execution of task and writes its header. The start time is followed
+// by a random suffix, so that executions starting in the same millisecond, in one run or in parallel runs, never
+// share a file.
+func open_task_log(dir string, task string, command string, started time.Time) (*os.File, error) {
+	task_dir := filepath.Join(dir, task_log_name(task))
+	if err := os.MkdirAll(task_dir, 0o755); err != nil {
+		return nil, err
+	}
+	file, err := os.CreateTemp(task_dir, started.UTC().Format(task_log_time_format)+"-*.log")
+	if err != nil {
+		return nil, err
+	}
+	if err := file.Chmod(0o644); err != nil {
+		file.Close()
+		return nil, err
+	}
+	fmt.Fprintf(file, "# task: %s\n# command: %s\n# started: %s\n", task, command, started.Format(time.RFC3339Nano))
+	return file, nil
+}
+
+// close_task_log writes the outcome of the execution as a trailer and closes the file
+func close_task_log(file *os.File, result task_result) {
+	line := fmt.Sprintf("# finished: %s %s after %s", time.Now().Format(time.RFC3339Nano), result.status,
+		result.duration.Round(time.Millisecond))
+	if result.err != nil {
+		line += ": " + result.err.Error()
+	}
+	fmt.Fprintln(file, line)
+	file.Close()
+}
+
+// list_task_logs returns the log files of task, oldest first
+func list_task_logs(dir string, task string) ([]string, error) {
+	entries, err := os.ReadDir(filepath.Join(dir, task_log_name(task)))
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var paths []string
+	for _, entry := range entries {
+		if !entry.IsDir() && strings.HasSuffix(entry.Name(), ".log") {
+			paths = append(paths, filepath.Join(dir, task_log_name(task), entry.Name()))
+		}
+	}
+	sort.Strings(paths)
+	return paths, nil
+}
+
+// run_logs prints the latest log file of a task, or lists all of them
+func run_logs(args []string) {
+	flags := flag.NewFlagSet("logs", flag.ExitOnError)
+	add_logging_flags(flags)
+	list := flags.Bool("list", false, "list every log file of the task instead of printing the latest")
+	add_task_log_flags(flags)
+	flags.Parse(args)
+
+	if flags.NArg() != 1 {
+		fatal_usage("usage", "usage", "dag logs [--list] TASK")
+	}
+	task := flags.Arg(0)
+
+	paths, err := list_task_logs(task_logs_dir, task)
+	if err != nil {
+		fatal("logs_read_failed", "error", err)
+	}
+	if len(paths) == 0 {
+		fatal("no_logs", "task", task, "dir", task_logs_dir)
+	}
+
+	if *list {
+		for _, path := range paths {
+			fmt.Println(path)
+		}
+		return
+	}
+	file, err := os.Open(paths[len(paths)-1])
+	if err != nil {
+		fatal("logs_read_failed", "error", err)
+	}
+	defer file.Close()
+	io.Copy(os.Stdout, file)
+}
@@ -0,0 +1,83 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func Test_task_log_name(t *testing.T) {
+	for _, task := range []string{"build", "go-1.22", "a.b"} {
+		if name := task_log_name(task); name != task {
+			t.Errorf("%q: got %q, want the name unchanged", task, name)
+		}
+	}
+
+	// Each group would share a directory without the hash
+	groups := [][]string{
+		{"install vs code", "install vs_code", "install vs/code", "install vs:code"},
+		{"Build", "build"},
+		{".", "..", "_", ""},
+	}
+	for _, group := range groups {
+		seen := make(map[string]string)
+		for _, task := range group {
+			name := task_log_name(task)
+			if other, ok := seen[strings.ToLower(name)]; ok {
+				t.Errorf("%q and %q share the log directory %q", task, other, name)
+			}
+			seen[strings.ToLower(name)] = task
+			if name == "." || name == ".." || strings.ContainsAny(name, ` /\:*?"<>|`) {
+				t.Errorf("%q: %q is not a valid directory name", task, name)
+			}
+		}
+	}
+}
+
+func Test_open_task_log_same_millisecond(t *testing.T) {
+	dir := t.TempDir()
+	started := time.Date(2026, 1, 2, 3, 4, 5, 6_000_000, time.UTC)
+	for i := 0; i < 3; i++ {
+		file, err := open_task_log(dir, "build", fmt.Sprintf("echo %d", i), started)
+		if err != nil {
+			t.Fatal(err)
+		}
+		close_task_log(file, task_result{status: status_succeeded})
+	}
+
+	paths, err := list_task_logs(dir, "build")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(paths) != 3 {
+		t.Fatalf("got %d log files, want one per execution: %v", len(paths), paths)
+	}
+	commands := make(map[string]bool)
+	for _, path := range paths {
+		if name := filepath.Base(path); !strings.HasPrefix(name, "20260102T030405.006Z-") {
+			t.Errorf("%s does not start with the start time", name)
+		}
+		content, err := os.ReadFile(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		commands[strings.Split(string(content), "\n")[1]] = true
+	}
+	if len(commands) != 3 {
+		t.Errorf("executions overwrote each other's logs: %v", commands)
+	}
+
+	// Files of a later millisecond still sort after them
+	file, err := open_task_log(dir, "build", "echo later", started.Add(time.Millisecond))
+	if err != nil {
+		t.Fatal(err)
+	}
+	file.Close()
+	paths, _ = list_task_logs(dir, "build")
+	if last := filepath.Base(paths[len(paths)-1]); !strings.HasPrefix(last, "20260102T030405.007Z-") {
+		t.Errorf("latest log is %s, want the one started last", last)
+	}
+}
@@ -0,0 +1,503 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+
+	"golang.org/x/term"
+)
+
+// Keys understood by the terminal UI
+const (
+	key_up      = "up"
+	key_down    = "down"
+	key_enter   = "enter"
+	key_back    = "back"
+	key_space   = "space"
+	key_page    = "page"
+	key_cancel  = "cancel" // ctrl+c: cancels a run, quits otherwise
+	key_unknown = ""
+)
+
+// Screens of the terminal UI
+const (
+	screen_levels  = "levels"
+	screen_details = "details"
+	screen_plan    = "plan"
+	screen_run     = "run"
+)
+
+// tui_row is one line of the level list: a level header or a task
+type tui_row struct {
+	level int
+	task  string // empty for level headers
+}
+
+// tui_state is everything the terminal UI draws
+type tui_state struct {
+	parsed   dag_file
+	levels   map[string]int
+	reverse  map[string][]string
+	rows     []tui_row
+	cursor   int // index into rows, always on a task
+	offset   int // first row shown
+	selected map[string]bool
+	screen   string
+	message  string
+	jobs     int
+
+	// run screen, guarded by mutex while a run is active
+	mutex      sync.Mutex
+	run_order  []string
+	run_status map[string]string
+	run_output map[string]string
+	run_counts map[string]int
+	run_active bool
+	run_cancel context.CancelFunc // stops the active run
+}
+
+// run_tui starts the interactive terminal UI
+func run_tui(args []string) {
+	flags := flag.NewFlagSet("tui", flag.ExitOnError)
+	add_logging_flags(flags)
+	jobs := flags.Int("jobs", 1, "maximum number of tasks a run executes at the same time")
+	add_source_flags(flags)
+	add_history_flags(flags)
+	add_task_log_flags(flags)
+	flags.Parse(args)
+
+	fd := int(os.Stdin.Fd())
+	if !term.IsTerminal(fd) {
+		fatal("not_a_terminal", "reason", "dag tui needs an interactive terminal")
+	}
+
+	require_fresh_source = true // the run screen executes the graph
+	parsed, err := load_dag_file()
+	if err != nil {
+		fatal_error("dag_load_failed", err)
+	}
+	if err := check_dag(parsed.Dag); err != nil {
+		fatal_error("dag_invalid", err)
+	}
+
+	state := new_tui_state(parsed, *jobs)
+
+	old_state, err := term.MakeRaw(fd)
+	if err != nil {
+		fatal("raw_mode_failed", "error", err)
+	}
+	defer term.Restore(fd, old_state)
+	fmt.Print("\x1b[?25l")
+	defer fmt.Print("\x1b[?25h\x1b[H\x1b[2J")
+
+	keys := make(chan string)
+	go read_keys(os.Stdin, keys)
+	redraw := make(chan struct{}, 1)
+
+	for {
+		width, height, err := term.GetSize(int(os.Stdout.Fd()))
+		if err != nil || width < 20 || height < 5 {
+			width, height = 80, 24
+		}
+		fmt.Print(render_tui(state, width, height))
+		select {
+		case key, ok := <-keys:
+			if !ok || handle_tui_key(state, key, redraw) {
+				return
+			}
+		case <-redraw:
+		}
+	}
+}
+
+// new_tui_state opens the level list of parsed with the cursor on the first task
+func new_tui_state(parsed dag_file, jobs int) *tui_state {
+	state := &tui_state{
+		parsed:   parsed,
+		levels:   compute_levels(parsed.Dag),
+		reverse:  build_reverse_graph(parsed.Dag),
+		selected: make(map[string]bool),
+		screen:   screen_levels,
+		jobs:     jobs,
+	}
+	state.rows = build_tui_rows(state.levels)
+	state.cursor = 1
+	return state
+}
+
+// build_tui_rows groups tasks by level, in the same order dag_level_sorted prints them
+func build_tui_rows(levels map[string]int) []tui_row {
+	grouped := make(map[int][]string)
+	for task, lvl := range levels {
+		grouped[lvl] = append(grouped[lvl], task)
+	}
+	var all_levels []int
+	for lvl := range grouped {
+		all_levels = append(all_levels, lvl)
+	}
+	sort.Ints(all_levels)
+
+	var rows []tui_row
+	for _, lvl := range all_levels {
+		rows = append(rows, tui_row{level: lvl})
+		sort.Strings(grouped[lvl])
+		for _, task := range grouped[lvl] {
+			rows = append(rows, tui_row{level: lvl, task: task})
+		}
+	}
+	return rows
+}
+
+// read_keys decodes key presses from input until it fails
+func read_keys(input io.Reader, keys chan<- string) {
+	defer close(keys)
+	buffer := make([]byte, 16)
+	for {
+		n, err := input.Read(buffer)
+		if err != nil {
+			return
+		}
+		keys <- decode_key(buffer[:n])
+	}
+}
+
+// decode_key maps raw terminal input to a key name; printable characters map to themselves
+func decode_key(input []byte) string {
+	switch string(input) {
+	case "\x1b[A", "k":
+		return key_up
+	case "\x1b[B", "j":
+		return key_down
+	case "\r", "\n", "l":
+		return key_enter
+	case "\x1b", "\x7f", "h", "\x1b[D":
+		return key_back
+	case " ":
+		return key_space
+	case "\x1b[6~":
+		return key_page
+	case "\x03":
+		return key_cancel
+	}
+	if len(input) == 1 && input[0] >= ' ' && input[0] < 0x7f {
+		return string(input)
+	}
+	return key_unknown
+}
+
+// handle_tui_key updates the state for one key press and reports whether the UI should quit.
+// q and ctrl+c quit unless a run is active; ctrl+c then cancels the run instead.
+func handle_tui_key(state *tui_state, key string, redraw chan struct{}) bool {
+	if (key == "q" || key == key_cancel) && !state.is_running() {
+		return true
+	}
+	state.message = ""
+	switch state.screen {
+	case screen_levels:
+		switch key {
+		case key_up:
+			state.move_cursor(-1)
+		case key_down:
+			state.move_cursor(1)
+		case key_page:
+			for i := 0; i < 10; i++ {
+				state.move_cursor(1)
+			}
+		case key_space:
+			task := state.rows[state.cursor].task
+			state.selected[task] = !state.selected[task]
+			if !state.selected[task] {
+				delete(state.selected, task)
+			}
+		case key_enter:
+			state.screen = screen_details
+		case "p":
+			state.screen = screen_plan
+		case "c":
+			state.selected = make(map[string]bool)
+		case "r":
+			start_tui_run(state, redraw)
+		}
+	case screen_details, screen_plan:
+		switch key {
+		case key_back, key_enter:
+			state.screen = screen_levels
+		case "r":
+			start_tui_run(state, redraw)
+		}
+	case screen_run:
+		switch {
+		case key == key_back && !state.is_running():
+			state.screen = screen_levels
+		case key == key_cancel || key == "x":
+			state.cancel_run()
+		}
+	}
+	return false
+}
+
+// move_cursor moves to the next task row in direction, skipping level headers
+func (state *tui_state) move_cursor(direction int) {
+	for i := state.cursor + direction; i >= 0 && i < len(state.rows); i += direction {
+		if state.rows[i].task != "" {
+			state.cursor = i
+			return
+		}
+	}
+}
+
+// is_running reports whether a run started from the UI is still active
+func (state *tui_state) is_running() bool {
+	state.mutex.Lock()
+	defer state.mutex.Unlock()
+	return state.run_active
+}
+
+// cancel_run stops the active run: running tasks are killed and the rest are reported as cancelled
+func (state *tui_state) cancel_run() {
+	state.mutex.Lock()
+	defer state.mutex.Unlock()
+	if state.run_active {
+		state.run_cancel()
+	}
+}
+
+// planned_tasks returns the selected tasks (or the task under the cursor) plus their dependencies
+func (state *tui_state) planned_tasks() map[string]bool {
+	var targets []string
+	for task := range state.selected {
+		targets = append(targets, task)
+	}
+	if len(targets) == 0 {
+		targets = []string{state.rows[state.cursor].task}
+	}
+	selected, _ := select_tasks(targets, state.parsed.Dag) // rows only hold tasks of the DAG
+	return selected
+}
+
+// start_tui_run executes the plan in the background, redrawing the run screen on every event
+func start_tui_run(state *tui_state, redraw chan struct{}) {
+	if state.is_running() {
+		return
+	}
+	selected := state.planned_tasks()
+	order, err := plan_order(selected, state.parsed.Dag)
+	if err != nil {
+		state.message = err.Error()
+		return
+	}
+
+	state.mutex.Lock()
+	state.run_order = order
+	state.run_status = make(map[string]string)
+	state.run_output = make(map[string]string)
+	state.run_counts = nil
+	state.run_active = true
+	ctx, cancel := context.WithCancel(context.Background())
+	state.run_cancel = cancel
+	state.mutex.Unlock()
+	state.screen = screen_run
+
+	history := new_history_recorder()
+	publish := func(event run_event) {
+		history.record(event)
+		state.mutex.Lock()
+		switch event.Type {
+		case event_task_started:
+			state.run_status[event.Task] = "running"
+		case event_task_output:
+			state.run_output[event.Task] = event.Output
+		case event_task_finished:
+			state.run_status[event.Task] = event.Status
+			if event.Blocked_by != "" {
+				state.run_output[event.Task] = "blocked by " + event.Blocked_by
+			}
+		case event_run_finished:
+			state.run_counts = event.Counts
+		}
+		state.mutex.Unlock()
+		select {
+		case redraw <- struct{}{}:
+		default:
+		}
+	}
+
+	go func() {
+		execute_plan(state.parsed.Dag, selected, run_options{
+			commands: state.parsed.Run,
+			policies: state.parsed.Policy,
+			jobs:     state.jobs,
+			console:  io.Discard,
+			publish:  publish,
+			logs_dir: task_logs_dir,
+			ctx:      ctx,
+		})
+		cancel()
+		state.mutex.Lock()
+		state.run_active = false
+		state.mutex.Unlock()
+		select {
+		case redraw <- struct{}{}:
+		default:
+		}
+	}()
+}
+
+// render_tui returns the escape sequences that redraw a terminal of width by height for the current state
+func render_tui(state *tui_state, width int, height int) string {
+	var lines []string
+	var footer string
+	switch state.screen {
+	case screen_levels:
+		lines = draw_levels_screen(state, height-2)
+		footer = "↑/↓ move · space select · enter details · p plan · r run · c clear · q quit"
+	case screen_details:
+		lines = draw_details_screen(state)
+		footer = "r run · esc back · q quit"
+	case screen_plan:
+		lines = draw_plan_screen(state)
+		footer = "r run · esc back · q quit"
+	case screen_run:
+		lines = draw_run_screen(state)
+		footer = "running… · x cancel"
+		if !state.is_running() {
+			footer = "esc back · q quit"
+		}
+	}
+	if state.message != "" {
+		footer = "❌ " + state.message
+	}
+
+	var out strings.Builder
+	out.WriteString("\x1b[H\x1b[2J")
+	for i, line := range lines {
+		if i >= height-2 {
+			break
+		}
+		out.WriteString(truncate_line(line, width))
+		out.WriteString("\r\n")
+	}
+	out.WriteString(fmt.Sprintf("\x1b[%d;1H\x1b[7m%s\x1b[0m", height, truncate_line(footer, width)))
+	return out.String()
+}
+
+// draw_levels_screen lists the tasks grouped by level, scrolled so the cursor stays visible
+func draw_levels_screen(state *tui_state, visible int) []string {
+	if state.cursor < state.offset+1 {
+		state.offset = state.cursor - 1
+	}
+	if state.cursor >= state.offset+visible-1 {
+		state.offset = state.cursor - visible + 2
+	}
+	if state.offset < 0 {
+		state.offset = 0
+	}
+
+	lines := []string{fmt.Sprintf("📊 DAG Levels (%d selected)", len(state.selected))}
+	for i := state.offset; i < len(state.rows); i++ {
+		row := state.rows[i]
+		if row.task == "" {
+			lines = append(lines, fmt.Sprintf("Level %d:", row.level))
+			continue
+		}
+		mark := "[ ]"
+		if state.selected[row.task] {
+			mark = "[x]"
+		}
+		line := fmt.Sprintf("  %s %s", mark, row.task)
+		if i == state.cursor {
+			line = "\x1b[7m" + line + "\x1b[0m"
+		}
+		lines = append(lines, line)
+	}
+	return lines
+}
+
+// draw_details_screen shows the direct and transitive dependencies and dependents of the task under the cursor
+func draw_details_screen(state *tui_state) []string {
+	task := state.rows[state.cursor].task
+	direct_deps := append([]string{}, state.parsed.Dag[task]...)
+	sort.Strings(direct_deps)
+
+	lines := []string{fmt.Sprintf("🔧 %s (level %d)", task, state.levels[task])}
+	if command := state.parsed.Run[task].script(); command != "" {
+		lines = append(lines, "   run: "+command)
+	}
+	section := func(title string, items []string) {
+		lines = append(lines, "", fmt.Sprintf("%s (%d):", title, len(items)))
+		for _, item := range items {
+			lines = append(lines, "  - "+item)
+		}
+	}
+	section("Direct dependencies", direct_deps)
+	section("All dependencies", resolve_all_dependencies(task, state.parsed.Dag))
+	section("Direct dependents", state.reverse[task])
+	section("All dependents", resolve_all_dependencies(task, state.reverse))
+	return lines
+}
+
+// draw_plan_screen shows the order a run of the selection would execute
+func draw_plan_screen(state *tui_state) []string {
+	order, err := plan_order(state.planned_tasks(), state.parsed.Dag)
+	if err != nil {
+		return []string{"❌ " + err.Error()}
+	}
+	lines := []string{fmt.Sprintf("🔁 plan (%d tasks):", len(order))}
+	for i, task := range order {
+		marker := ""
+		if state.selected[task] {
+			marker = " ★"
+		}
+		lines = append(lines, fmt.Sprintf("%2d. %s%s", i+1, task, marker))
+	}
+	return lines
+}
+
+// draw_run_screen shows the live status of every task in the run
+func draw_run_screen(state *tui_state) []string {
+	state.mutex.Lock()
+	defer state.mutex.Unlock()
+
+	icons := map[string]string{
+		"":               "⏳",
+		"running":        "▶️",
+		status_succeeded: "✅",
+		status_failed:    "❌",
+		status_skipped:   "⏭️",
+		status_cancelled: "🛑",
+	}
+	lines := []string{"🚀 run"}
+	for _, task := range state.run_order {
+		status := state.run_status[task]
+		line := fmt.Sprintf("  %s %s", icons[status], task)
+		if output := state.run_output[task]; output != "" {
+			line += "  · " + output
+		}
+		lines = append(lines, line)
+	}
+	if state.run_counts != nil {
+		lines = append(lines, "", fmt.Sprintf("📋 %d succeeded, %d failed, %d skipped, %d cancelled",
+			state.run_counts[status_succeeded], state.run_counts[status_failed], state.run_counts[status_skipped],
+			state.run_counts[status_cancelled]))
+	}
+	return lines
+}
+
+// truncate_line shortens line to at most width runes, resetting colours it may have cut off
+func truncate_line(line string, width int) string {
+	runes := []rune(line)
+	if len(runes) <= width {
+		return line
+	}
+	truncated := string(runes[:width-1]) + "…"
+	if strings.Contains(line, "\x1b[") {
+		truncated += "\x1b[0m"
+	}
+	return truncated
+}
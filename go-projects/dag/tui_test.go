@@ -0,0 +1,192 @@
+package main
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+// test_tui opens the terminal UI state of the diamond fixture, whose rows are
+// Level 1, base, Level 2, left, right, Level 3, top
+func test_tui() *tui_state {
+	return new_tui_state(dag_file{Dag: diamond_dag}, 2)
+}
+
+// press sends keys to state, failing the test if one of them quits
+func press(t *testing.T, state *tui_state, keys ...string) {
+	t.Helper()
+	for _, key := range keys {
+		if handle_tui_key(state, key, make(chan struct{}, 1)) {
+			t.Fatalf("%q quit the UI", key)
+		}
+	}
+}
+
+func Test_decode_key(t *testing.T) {
+	tests := []struct {
+		input string
+		want  string
+	}{
+		{"\x1b[A", key_up},
+		{"k", key_up},
+		{"\x1b[B", key_down},
+		{"j", key_down},
+		{"\r", key_enter},
+		{"l", key_enter},
+		{"\x1b", key_back},
+		{"\x7f", key_back},
+		{"\x1b[D", key_back},
+		{" ", key_space},
+		{"\x1b[6~", key_page},
+		{"\x03", key_cancel},
+		{"p", "p"},
+		{"\x1b[C", key_unknown},
+		{"\x01", key_unknown},
+		{"ab", key_unknown},
+	}
+	for _, test := range tests {
+		if got := decode_key([]byte(test.input)); got != test.want {
+			t.Errorf("decode_key(%q) = %q, want %q", test.input, got, test.want)
+		}
+	}
+}
+
+func Test_tui_cursor_skips_level_headers(t *testing.T) {
+	tests := []struct {
+		keys []string
+		want string
+	}{
+		{nil, "base"},
+		{[]string{key_down}, "left"},
+		{[]string{key_down, key_down, key_down}, "top"},
+		{[]string{key_down, key_down, key_down, key_down}, "top"},
+		{[]string{key_up}, "base"},
+		{[]string{key_page, key_up}, "right"},
+	}
+	for _, test := range tests {
+		state := test_tui()
+		press(t, state, test.keys...)
+		if got := state.rows[state.cursor].task; got != test.want {
+			t.Errorf("%q: cursor on %q, want %q", test.keys, got, test.want)
+		}
+	}
+}
+
+func Test_tui_select_and_plan(t *testing.T) {
+	state := test_tui()
+	press(t, state, key_space, key_space)
+	if len(state.selected) != 0 {
+		t.Errorf("space twice: selected %v, want none", state.selected)
+	}
+
+	press(t, state, key_down, key_space, "p")
+	if state.screen != screen_plan {
+		t.Fatalf("p: screen %q, want %q", state.screen, screen_plan)
+	}
+	screen := render_tui(state, 80, 24)
+	for _, want := range []string{"plan (2 tasks):", " 1. base\r\n", " 2. left ★\r\n", "esc back"} {
+		if !strings.Contains(screen, want) {
+			t.Errorf("plan screen lacks %q:\n%q", want, screen)
+		}
+	}
+
+	press(t, state, key_back, "c")
+	if state.screen != screen_levels || len(state.selected) != 0 {
+		t.Errorf("esc, c: screen %q with %v selected, want the level list without a selection", state.screen, state.selected)
+	}
+}
+
+func Test_tui_details(t *testing.T) {
+	state := test_tui()
+	press(t, state, key_down, key_enter)
+	screen := render_tui(state, 80, 24)
+	for _, want := range []string{
+		"🔧 left (level 2)",
+		"Direct dependencies (1):\r\n  - base\r\n",
+		"Direct dependents (1):\r\n  - top\r\n",
+	} {
+		if !strings.Contains(screen, want) {
+			t.Errorf("details screen lacks %q:\n%q", want, screen)
+		}
+	}
+	press(t, state, key_enter)
+	if state.screen != screen_levels {
+		t.Errorf("enter on details: screen %q, want %q", state.screen, screen_levels)
+	}
+}
+
+func Test_render_tui_levels(t *testing.T) {
+	state := test_tui()
+	press(t, state, key_down, key_space)
+	screen := render_tui(state, 80, 24)
+	for _, want := range []string{"📊 DAG Levels (1 selected)", "Level 2:", "\x1b[7m  [x] left\x1b[0m", "  [ ] right"} {
+		if !strings.Contains(screen, want) {
+			t.Errorf("level screen lacks %q:\n%q", want, screen)
+		}
+	}
+
+	// Three rows fit above the footer of a five-line terminal; the cursor stays on one of them
+	press(t, state, key_page)
+	screen = render_tui(state, 20, 5)
+	if !strings.Contains(screen, "  [ ] top") || strings.Contains(screen, "base") {
+		t.Errorf("scrolled screen does not end at top:\n%q", screen)
+	}
+	if !strings.Contains(screen, "\x1b[5;1H\x1b[7m↑/↓ move · space se…\x1b[0m") {
+		t.Errorf("footer not truncated to the width:\n%q", screen)
+	}
+}
+
+func Test_tui_quit(t *testing.T) {
+	for _, key := range []string{"q", key_cancel} {
+		if !handle_tui_key(test_tui(), key, make(chan struct{}, 1)) {
+			t.Errorf("%q did not quit", key)
+		}
+	}
+}
+
+func Test_tui_run(t *testing.T) {
+	state := test_tui()
+	redraw := make(chan struct{}, 1)
+	press(t, state, key_page)
+	if handle_tui_key(state, "r", redraw) || state.screen != screen_run {
+		t.Fatalf("r: screen %q, want %q", state.screen, screen_run)
+	}
+
+	// Without run commands every task succeeds at once
+	deadline := time.After(5 * time.Second)
+	for state.is_running() {
+		select {
+		case <-redraw:
+		case <-deadline:
+			t.Fatal("run did not finish")
+		}
+	}
+	screen := render_tui(state, 80, 24)
+	for _, want := range []string{"✅ base", "✅ top", "4 succeeded, 0 failed", "esc back"} {
+		if !strings.Contains(screen, want) {
+			t.Errorf("run screen lacks %q:\n%q", want, screen)
+		}
+	}
+	press(t, state, key_back)
+	if state.screen != screen_levels {
+		t.Errorf("esc after the run: screen %q, want %q", state.screen, screen_levels)
+	}
+}
+
+func Test_truncate_line(t *testing.T) {
+	tests := []struct {
+		line  string
+		width int
+		want  string
+	}{
+		{"short", 10, "short"},
+		{"exactly10!", 10, "exactly10!"},
+		{"a long line", 6, "a lon…"},
+		{"\x1b[7mselected\x1b[0m", 8, "\x1b[7msel…\x1b[0m"},
+	}
+	for _, test := range tests {
+		if got := truncate_line(test.line, test.width); got != test.want {
+			t.Errorf("truncate_line(%q, %d) = %q, want %q", test.line, test.width, got, test.want)
+		}
+	}
+}
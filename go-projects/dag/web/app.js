@@ -0,0 +1,216 @@
+// Renders the DAG served by `dag serve` as columns of levels and follows run events.
+"use strict";
+
+const column_width = 300;
+const row_height = 34;
+const node_width = 260;
+const node_height = 24;
+const margin = 30;
+
+const svg_ns = "http://www.w3.org/2000/svg";
+
+let tasks = {};        // name -> task_info from /tasks
+let positions = {};    // name -> {x, y}
+let node_elements = {};
+let edge_elements = [];
+let selected = null;
+
+// svg_element creates an SVG element with the given attributes
+function svg_element(tag, attributes) {
+  const element = document.createElementNS(svg_ns, tag);
+  for (const [key, value] of Object.entries(attributes)) {
+    element.setAttribute(key, value);
+  }
+  return element;
+}
+
+// fetch_json fetches a path of the API and decodes the JSON body
+async function fetch_json(path, options) {
+  const response = await fetch(path, options);
+  if (!response.ok) {
+    throw new Error(`${path}: ${response.status}`);
+  }
+  return response.json();
+}
+
+// draw_graph lays out one column per level, with tasks sorted by name inside each column
+function draw_graph(levels) {
+  const graph = document.getElementById("graph");
+  graph.innerHTML = "";
+
+  const tallest = Math.max(...levels.map(level => level.tasks.length));
+  const svg = svg_element("svg", {
+    width: margin * 2 + levels.length * column_width,
+    height: margin * 2 + 20 + tallest * row_height,
+  });
+
+  levels.forEach((level, column) => {
+    const x = margin + column * column_width;
+    const label = svg_element("text", { x: x, y: margin, class: "level-label" });
+    label.textContent = `Level ${level.level}`;
+    svg.appendChild(label);
+    level.tasks.forEach((name, row) => {
+      positions[name] = { x: x, y: margin + 20 + row * row_height };
+    });
+  });
+
+  const edges = svg_element("g", {});
+  svg.appendChild(edges);
+  for (const task of Object.values(tasks)) {
+    for (const dep of task.dependencies) {
+      const from = positions[task.name];
+      const to = positions[dep];
+      const path = svg_element("path", {
+        class: "edge",
+        d: `M ${from.x} ${from.y + node_height / 2} ` +
+           `C ${from.x - 40} ${from.y + node_height / 2}, ` +
+           `${to.x + node_width + 40} ${to.y + node_height / 2}, ` +
+           `${to.x + node_width} ${to.y + node_height / 2}`,
+      });
+      path.dataset.from = task.name;
+      path.dataset.to = dep;
+      edges.appendChild(path);
+      edge_elements.push(path);
+    }
+  }
+
+  for (const [name, position] of Object.entries(positions)) {
+    const group = svg_element("g", { class: "node", transform: `translate(${position.x}, ${position.y})` });
+    group.appendChild(svg_element("rect", { width: node_width, height: node_height }));
+    const text = svg_element("text", { x: 8, y: 16 });
+    text.textContent = name;
+    group.appendChild(text);
+    group.addEventListener("click", () => select_task(name));
+    svg.appendChild(group);
+    node_elements[name] = group;
+  }
+
+  graph.appendChild(svg);
+}
+
+// select_task highlights the transitive dependencies and dependents of name, or clears the selection
+async function select_task(name) {
+  const details = document.getElementById("details");
+  const run_button = document.getElementById("run-selected");
+
+  if (selected === name) {
+    selected = null;
+    run_button.disabled = true;
+    for (const element of Object.values(node_elements)) {
+      element.classList.remove("faded", "selected", "dependency", "dependent");
+    }
+    for (const edge of edge_elements) {
+      edge.classList.remove("faded", "highlighted");
+    }
+    details.innerHTML = "<p>Click a task to highlight its transitive dependencies and dependents.</p>";
+    return;
+  }
+  selected = name;
+  run_button.disabled = false;
+
+  const [deps, dependents] = await Promise.all([
+    fetch_json(`/tasks/${encodeURIComponent(name)}/deps`),
+    fetch_json(`/tasks/${encodeURIComponent(name)}/dependents`),
+  ]);
+  const dependency_set = new Set(deps.transitive);
+  const dependent_set = new Set(dependents.transitive);
+  const related = new Set([name, ...dependency_set, ...dependent_set]);
+
+  for (const [task, element] of Object.entries(node_elements)) {
+    element.classList.toggle("selected", task === name);
+    element.classList.toggle("dependency", dependency_set.has(task));
+    element.classList.toggle("dependent", dependent_set.has(task));
+    element.classList.toggle("faded", !related.has(task));
+  }
+  for (const edge of edge_elements) {
+    const on_path = related.has(edge.dataset.from) && related.has(edge.dataset.to);
+    edge.classList.toggle("highlighted", on_path);
+    edge.classList.toggle("faded", !on_path);
+  }
+
+  const list = items => items.length
+    ? "<ul>" + items.map(item => `<li>${escape_html(item)}</li>`).join("") + "</ul>"
+    : "<p>none</p>";
+  const task = tasks[name];
+  details.innerHTML =
+    `<h2>${escape_html(name)}</h2>` +
+    `<p>Level ${task.level}${task.tags ? " · " + task.tags.map(escape_html).join(", ") : ""}</p>` +
+    (task.run ? `<pre>${escape_html(task.run)}</pre>` : "") +
+    `<h3>Dependencies (${deps.transitive.length})</h3>` + list(deps.transitive) +
+    `<h3>Dependents (${dependents.transitive.length})</h3>` + list(dependents.transitive);
+}
+
+// escape_html makes text safe to insert as HTML
+function escape_html(text) {
+  const element = document.createElement("span");
+  element.textContent = text;
+  return element.innerHTML;
+}
+
+// set_task_status colours a node by its latest run status
+function set_task_status(name, status) {
+  const element = node_elements[name];
+  if (!element) {
+    return;
+  }
+  element.classList.remove("running", "succeeded", "failed", "skipped", "cancelled");
+  if (status) {
+    element.classList.add(status);
+  }
+}
+
+// follow_events colours nodes from the live event stream
+function follow_events() {
+  const status = document.getElementById("status");
+  const events = new EventSource("/events");
+  events.addEventListener("task_started", message => {
+    const event = JSON.parse(message.data);
+    set_task_status(event.task, "running");
+    status.textContent = `run ${event.run}: ${event.task} started`;
+  });
+  events.addEventListener("task_finished", message => {
+    const event = JSON.parse(message.data);
+    set_task_status(event.task, event.status);
+  });
+  events.addEventListener("run_finished", message => {
+    const event = JSON.parse(message.data);
+    const counts = event.counts || {};
+    status.textContent = `run ${event.run} finished: ${counts.succeeded || 0} succeeded, ` +
+      `${counts.failed || 0} failed, ${counts.skipped || 0} skipped, ${counts.cancelled || 0} cancelled`;
+  });
+}
+
+// run_selected starts a run of the selected task and its dependencies
+async function run_selected() {
+  if (!selected) {
+    return;
+  }
+  for (const name of Object.keys(node_elements)) {
+    set_task_status(name, null);
+  }
+  const run = await fetch_json("/runs", {
+    method: "POST",
+    headers: { "Content-Type": "application/json" },
+    body: JSON.stringify({ targets: [selected] }),
+  });
+  document.getElementById("status").textContent = `run ${run.id} started`;
+}
+
+async function main() {
+  const status = document.getElementById("status");
+  try {
+    const [task_list, levels] = await Promise.all([fetch_json("/tasks"), fetch_json("/levels")]);
+    for (const task of task_list) {
+      tasks[task.name] = task;
+    }
+    draw_graph(levels);
+    status.textContent = `${task_list.length} tasks on ${levels.length} levels`;
+  } catch (error) {
+    status.textContent = `❌ ${error.message}`;
+    return;
+  }
+  document.getElementById("run-selected").addEventListener("click", run_selected);
+  follow_events();
+}
+
+main();
@@ -0,0 +1,302 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+)
+
+// default_path_limit is how many paths why and paths list by default; wide DAGs have exponentially many
+const default_path_limit = 100
+
+// path_info is the JSON view of the dependency paths from one task to another, printed by why --json and
+// paths --json and served at /why and /paths
+type path_info struct {
+	From  string     `json:"from"`
+	To    string     `json:"to"`
+	Paths [][]string `json:"paths"`
+	Total int        `json:"total"` // paths of any length, whether listed or not
+	More  bool       `json:"more"`  // --limit left paths out
+}
+
+// run_why prints the dependency chains that lead from one task to another
+func run_why(args []string) {
+	flags := flag.NewFlagSet("why", flag.ExitOnError)
+	add_logging_flags(flags)
+	shortest := flags.Bool("shortest", false, "only print the shortest paths")
+	longest := flags.Bool("longest", false, "only print the longest paths")
+	limit := flags.Int("limit", default_path_limit, "list at most this many paths (0 for all)")
+	json_output := flags.Bool("json", false, "print the paths as JSON")
+	add_source_flags(flags)
+	flags.Parse(args)
+
+	if flags.NArg() != 2 {
+		fatal_usage("usage", "usage", "dag why [--shortest|--longest] [--limit N] [--json] TASK DEPENDENCY")
+	}
+	if *shortest && *longest {
+		fatal_usage("conflicting_flags", "flags", "--shortest --longest")
+	}
+	from, to := flags.Arg(0), flags.Arg(1)
+
+	dag, err := load_dag()
+	if err != nil {
+		fatal_error("dag_load_failed", err)
+	}
+	if err := check_dag(dag); err != nil {
+		fatal_error("dag_invalid", err)
+	}
+	for _, task := range []string{from, to} {
+		if err := check_task_exists(task, dag); err != nil {
+			fatal_error("unknown_task", err)
+		}
+	}
+
+	length := path_length(from, to, dag, *shortest, *longest)
+	info := describe_paths(from, to, dag, length, *limit)
+	if *json_output {
+		print_json(os.Stdout, info)
+		return
+	}
+	if info.Total == 0 {
+		fmt.Printf("🚫 %s does not depend on %s\n", from, to)
+		return
+	}
+
+	fmt.Printf("🔎 why %s depends on %s:\n", from, to)
+	for i, path := range info.Paths {
+		fmt.Printf("%2d. %s\n", i+1, strings.Join(path, " → "))
+	}
+	if info.More {
+		total := info.Total
+		if length != 0 {
+			total = -1
+		}
+		print_path_limit(len(info.Paths), total)
+	}
+}
+
+// run_paths prints the number of dependency paths from one task to another
+func run_paths(args []string) {
+	flags := flag.NewFlagSet("paths", flag.ExitOnError)
+	add_logging_flags(flags)
+	count := flags.Bool("count", false, "print the number of paths instead of listing them")
+	limit := flags.Int("limit", default_path_limit, "list at most this many paths (0 for all)")
+	json_output := flags.Bool("json", false, "print the paths and their number as JSON")
+	add_source_flags(flags)
+	flags.Parse(args)
+
+	if flags.NArg() != 2 {
+		fatal_usage("usage", "usage", "dag paths [--count] [--limit N] [--json] TASK DEPENDENCY")
+	}
+	from, to := flags.Arg(0), flags.Arg(1)
+
+	dag, err := load_dag()
+	if err != nil {
+		fatal_error("dag_load_failed", err)
+	}
+	if err := check_dag(dag); err != nil {
+		fatal_error("dag_invalid", err)
+	}
+	for _, task := range []string{from, to} {
+		if err := check_task_exists(task, dag); err != nil {
+			fatal_error("unknown_task", err)
+		}
+	}
+
+	if *json_output {
+		print_json(os.Stdout, describe_paths(from, to, dag, 0, *limit))
+		return
+	}
+	if *count {
+		fmt.Printf("🔢 %d path(s) from %s to %s\n", count_paths(from, to, dag), from, to)
+		return
+	}
+
+	paths, more := limited_paths(from, to, dag, 0, *limit)
+	for _, path := range paths {
+		fmt.Println(strings.Join(path, " → "))
+	}
+	if more {
+		print_path_limit(len(paths), count_paths(from, to, dag))
+	}
+}
+
+// path_length returns the number of nodes on the shortest or longest paths from one task to another, or 0 for
+// paths of any length
+func path_length(from string, to string, dag map[string][]string, shortest bool, longest bool) int {
+	bounds, ok := path_bounds(from, to, dag)[from]
+	switch {
+	case !ok || from == to:
+		return 0
+	case shortest:
+		return bounds[0] + 1
+	case longest:
+		return bounds[1] + 1
+	}
+	return 0
+}
+
+// describe_paths lists at most limit paths from one task to another with length nodes (any length if 0)
+func describe_paths(from string, to string, dag map[string][]string, length int, limit int) path_info {
+	paths, more := limited_paths(from, to, dag, length, limit)
+	if paths == nil {
+		paths = [][]string{}
+	}
+	return path_info{From: from, To: to, Paths: paths, Total: count_paths(from, to, dag), More: more}
+}
+
+// limited_paths returns at most limit paths of find_paths (all if 0), and whether there are more
+func limited_paths(from string, to string, dag map[string][]string, length int, limit int) ([][]string, bool) {
+	if limit == 0 {
+		return find_paths(from, to, dag, length, 0), false
+	}
+	paths := find_paths(from, to, dag, length, limit+1)
+	if len(paths) <= limit {
+		return paths, false
+	}
+	// The extra path shows there are more; drop the one that sorts last
+	return paths[:limit], true
+}
+
+// print_path_limit notes that --limit cut a listing short; total is -1 when only paths of one length were listed
+func print_path_limit(listed int, total int) {
+	if total < 0 {
+		fmt.Printf("✂️ listed %d path(s), there are more; raise --limit to see them\n", listed)
+		return
+	}
+	fmt.Printf("✂️ listed %d of %d path(s); raise --limit to see more\n", listed, total)
+}
+
+// check_task_exists returns an error wrapping ErrUnknownTask if task is not a key of the DAG
+func check_task_exists(task string, dag map[string][]string) error {
+	if _, ok := dag[task]; !ok {
+		return fmt.Errorf("%w: %s", ErrUnknownTask, task)
+	}
+	return nil
+}
+
+// path_bounds returns the fewest and the most edges on a dependency path from task to target, for task and
+// every task it depends on that reaches target. Tasks that do not reach target have no entry.
+func path_bounds(task string, target string, dag map[string][]string) map[string][2]int {
+	bounds := map[string][2]int{target: {0, 0}}
+	visited := make(map[string]bool)
+	var visit func(string)
+	visit = func(node string) {
+		if visited[node] || node == target {
+			return
+		}
+		visited[node] = true
+		for _, dep := range dag[node] {
+			visit(dep)
+			dep_bounds, ok := bounds[dep]
+			if !ok {
+				continue
+			}
+			current, seen := bounds[node]
+			if !seen {
+				current = [2]int{dep_bounds[0] + 1, dep_bounds[1] + 1}
+			}
+			current[0] = min(current[0], dep_bounds[0]+1)
+			current[1] = max(current[1], dep_bounds[1]+1)
+			bounds[node] = current
+		}
+	}
+	visit(task)
+	return bounds
+}
+
+// find_paths lists the dependency paths from task to target with length nodes (any length if 0), stopping after
+// limit paths (all of them if 0). The walk only enters tasks that can still reach target with the right length,
+// so it does work per listed path rather than per path in the graph. Paths are sorted by length, then
+// lexicographically; with a limit they are the first ones in lexicographic walk order.
+func find_paths(task string, target string, dag map[string][]string, length int, limit int) [][]string {
+	// A task trivially reaches itself, but that is not a dependency
+	if task == target {
+		return nil
+	}
+	bounds := path_bounds(task, target, dag)
+	if _, ok := bounds[task]; !ok {
+		return nil
+	}
+
+	var paths [][]string
+	path := []string{task}
+	var walk func(string) bool // false once limit paths were found
+	walk = func(node string) bool {
+		if node == target {
+			paths = append(paths, append([]string(nil), path...))
+			return limit == 0 || len(paths) < limit
+		}
+		deps := append([]string(nil), dag[node]...)
+		sort.Strings(deps)
+		for _, dep := range deps {
+			dep_bounds, ok := bounds[dep]
+			if !ok {
+				continue
+			}
+			if remaining := length - len(path) - 1; length != 0 && (remaining < dep_bounds[0] || remaining > dep_bounds[1]) {
+				continue
+			}
+			path = append(path, dep)
+			more := walk(dep)
+			path = path[:len(path)-1]
+			if !more {
+				return false
+			}
+		}
+		return true
+	}
+	walk(task)
+
+	sort.Slice(paths, func(i, j int) bool {
+		if len(paths[i]) != len(paths[j]) {
+			return len(paths[i]) < len(paths[j])
+		}
+		return compare_lexicographic(paths[i], paths[j])
+	})
+	return paths
+}
+
+// count_paths returns the number of dependency paths from task to target. Each task's count is the sum of its
+// dependencies' counts, computed once, so no path is ever built.
+func count_paths(task string, target string, dag map[string][]string) int {
+	if task == target {
+		return 0
+	}
+
+	cache := make(map[string]int)
+
+	var count_from func(string) int
+	count_from = func(node string) int {
+		if cached, ok := cache[node]; ok {
+			return cached
+		}
+		if node == target {
+			cache[node] = 1
+			return 1
+		}
+		total := 0
+		for _, dep := range dag[node] {
+			total += count_from(dep)
+		}
+		cache[node] = total
+		return total
+	}
+
+	return count_from(task)
+}
+
+// compare_lexicographic reports whether a sorts before b element by element
+func compare_lexicographic(a, b []string) bool {
+	for i := 0; i < len(a) && i < len(b); i++ {
+		if a[i] < b[i] {
+			return true
+		}
+		if a[i] > b[i] {
+			return false
+		}
+	}
+	return len(a) < len(b)
+}
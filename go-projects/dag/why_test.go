@@ -0,0 +1,91 @@
+package main
+
+import (
+	"fmt"
+	"reflect"
+	"testing"
+)
+
+// ladder_dag returns a graph of rungs layers with two tasks each, every task depending on both tasks of the layer
+// below: 2^rungs paths lead from the top to the bottom
+func ladder_dag(rungs int) map[string][]string {
+	dag := map[string][]string{"bottom": {}}
+	below := []string{"bottom"}
+	for i := 1; i <= rungs; i++ {
+		layer := []string{fmt.Sprintf("l%02d", i), fmt.Sprintf("r%02d", i)}
+		for _, task := range layer {
+			dag[task] = below
+		}
+		below = layer
+	}
+	dag["top"] = below
+	return dag
+}
+
+func Test_find_paths(t *testing.T) {
+	all := [][]string{{"top", "base"}, {"top", "left", "base"}, {"top", "right", "base"}}
+	tests := []struct {
+		name     string
+		from, to string
+		length   int
+		limit    int
+		want     [][]string
+	}{
+		{"all", "top", "base", 0, 0, all},
+		{"shortest", "top", "base", 2, 0, all[:1]},
+		{"longest", "top", "base", 3, 0, all[1:]},
+		{"limit", "top", "base", 0, 2, all[:2]},
+		{"itself", "top", "top", 0, 0, nil},
+		{"unreachable", "left", "right", 0, 0, nil},
+		{"reverse", "base", "top", 0, 0, nil},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got := find_paths(test.from, test.to, diamond_dag, test.length, test.limit)
+			if !reflect.DeepEqual(got, test.want) {
+				t.Errorf("got %v, want %v", got, test.want)
+			}
+		})
+	}
+}
+
+func Test_count_paths(t *testing.T) {
+	tests := []struct {
+		dag      map[string][]string
+		from, to string
+		want     int
+	}{
+		{diamond_dag, "top", "base", 3},
+		{diamond_dag, "left", "base", 1},
+		{diamond_dag, "left", "right", 0},
+		{diamond_dag, "top", "top", 0},
+		{ladder_dag(40), "top", "bottom", 1 << 40},
+	}
+	for _, test := range tests {
+		if got := count_paths(test.from, test.to, test.dag); got != test.want {
+			t.Errorf("%s → %s: got %d, want %d", test.from, test.to, got, test.want)
+		}
+	}
+}
+
+// Test_find_paths_wide lists a few of the 2^40 paths of a ladder without enumerating the rest
+func Test_find_paths_wide(t *testing.T) {
+	dag := ladder_dag(40)
+	paths := find_paths("top", "bottom", dag, 0, 5)
+	if len(paths) != 5 {
+		t.Fatalf("got %d paths, want 5", len(paths))
+	}
+	for _, path := range paths {
+		if len(path) != 42 || path[0] != "top" || path[len(path)-1] != "bottom" {
+			t.Errorf("not a path from top to bottom: %v", path)
+		}
+	}
+
+	bounds := path_bounds("top", "bottom", dag)["top"]
+	if bounds != [2]int{41, 41} {
+		t.Errorf("bounds of top = %v, want [41 41]", bounds)
+	}
+	if paths := find_paths("top", "bottom", dag, 3, 5); len(paths) != 0 {
+		t.Errorf("got %d paths of 3 tasks, want none", len(paths))
+	}
+}
@@ -1,15 +0,0 @@
-module reverse_graph_deeper_beats_shallow_stop_dependents_details_compare_on_same_level
-
-go 1.24.4
-
-require (
-	github.com/PeterCullenBurbery/go_functions_002/v3 v3.4.1
-	gopkg.in/yaml.v3 v3.0.1
-)
-
-require (
-	github.com/go-ole/go-ole v1.3.0 // indirect
-	github.com/yeka/zip v0.0.0-20231116150916-03d6312748a9 // indirect
-	golang.org/x/crypto v0.39.0 // indirect
-	golang.org/x/sys v0.33.0 // indirect
-)